@@ -20,6 +20,8 @@ var (
 	shardCount    = flag.Int("shard-count", 5, "number of output shards")
 	recordSize    = flag.Int("record-bytes", 1024*1024*3, "output tfrecords prefix")
 	recordCount   = flag.Int("record-count", 1000, "output tfrecords prefix")
+	bundleFiles   = flag.Bool("bundle-files", false, "write a temporary file per bundle instead of grouping records by shard")
+	shardBytes    = flag.Int64("target-shard-bytes", 0, "if positive, choose the number of shards so each holds about this many bytes instead of using --shard-count")
 )
 
 func init() {
@@ -50,7 +52,16 @@ func run(ctx context.Context) error {
 	}, seeds)
 	records = beamgen.Reshuffle(s.Scope("ReshuffleRecords"), records)
 
-	tfrecordio.WriteSharded(s, *recordsOutput, *shardCount, records)
+	var writeOpts []tfrecordio.WriteOption
+	if *bundleFiles {
+		writeOpts = append(writeOpts, tfrecordio.WithWriteMode(tfrecordio.WriteModeBundleFiles))
+	}
+	outputShards := *shardCount
+	if *shardBytes > 0 {
+		outputShards = 0
+		writeOpts = append(writeOpts, tfrecordio.WithTargetShardBytes(*shardBytes))
+	}
+	tfrecordio.WriteSharded(s, *recordsOutput, outputShards, records, writeOpts...)
 
 	if err := beamx.Run(ctx, p); err != nil {
 		return fmt.Errorf("failed to execute job: %w", err)
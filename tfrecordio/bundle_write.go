@@ -0,0 +1,205 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+	"github.com/google/uuid"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*writeBundleFileFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*writeBundleFileFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*assignTempFilesFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*assignTempFilesFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*copyTempFilesFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*copyTempFilesFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*shardTempFiles)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*shardTempFiles)(nil)).Elem())
+}
+
+// writeBundleFiles implements WriteModeBundleFiles. The temporary files of
+// each bundle are written to the output's temporary directory and are removed
+// when the shards are finalized.
+func writeBundleFiles(s beam.Scope, out shardedOutput, shardCount beamgen.Collection[int], col beamgen.Collection[[]byte]) beamgen.Collection[pendingShard] {
+	tempFiles := beamgen.ParDo1[[]byte, string](s.Scope("WriteBundleFiles"), &writeBundleFileFn{TempDir: out.TempDir}, col)
+
+	// Only the names of the temporary files are shuffled, so the size of the
+	// records doesn't matter here.
+	grouped := beamgen.GroupByKey(s, beamgen.AddFixedKey(s, tempFiles))
+	shards := beamgen.ParDoUnsafe[beamgen.GroupedByKey[int, string], shardTempFiles](s.Scope("AssignTempFiles"), &assignTempFilesFn{}, grouped,
+		beam.SideInput{Input: shardCount.PCollection()})
+	shards = beamgen.Reshuffle(s.Scope("ReshuffleShards"), shards)
+
+	return beamgen.ParDo1[shardTempFiles, pendingShard](s.Scope("CopyTempFiles"), &copyTempFilesFn{Output: out}, shards)
+}
+
+// writeBundleFileFn writes the records of each bundle to a new temporary file
+// and emits the name of the file when the bundle finishes.
+type writeBundleFileFn struct {
+	TempDir string `json:"tempDir"`
+
+	fs           filesystem.Interface
+	fd           io.WriteCloser
+	recordWriter *tfrecord.RecordWriter
+	filename     string
+}
+
+func (w *writeBundleFileFn) ProcessElement(ctx context.Context, record []byte, emit func(string)) error {
+	if w.recordWriter == nil {
+		if err := w.open(ctx); err != nil {
+			return err
+		}
+	}
+	if err := w.recordWriter.WriteRecord(record); err != nil {
+		return fmt.Errorf("error writing record to %s: %w", w.filename, err)
+	}
+	return nil
+}
+
+func (w *writeBundleFileFn) open(ctx context.Context) error {
+	w.filename = w.TempDir + "bundle-" + uuid.NewString()
+
+	fs, err := filesystem.New(ctx, w.filename)
+	if err != nil {
+		return err
+	}
+	fd, err := fs.OpenWrite(ctx, w.filename)
+	if err != nil {
+		fs.Close()
+		return fmt.Errorf("error opening %s for writing: %w", w.filename, err)
+	}
+	recordWriter, err := tfrecord.NewWriterFrom(fd, &tfrecord.RecordWriterOptions{
+		CompressionType: tfrecord.CompressionTypeNone,
+	})
+	if err != nil {
+		fs.Close()
+		return fmt.Errorf("error creating record writer: %w", err)
+	}
+
+	w.fs, w.fd, w.recordWriter = fs, fd, recordWriter
+	return nil
+}
+
+func (w *writeBundleFileFn) FinishBundle(ctx context.Context, emit func(string)) error {
+	if w.recordWriter == nil {
+		return nil
+	}
+	defer func() {
+		w.fs.Close()
+		w.fs, w.fd, w.recordWriter = nil, nil, nil
+	}()
+
+	if err := w.recordWriter.Close(); err != nil {
+		return fmt.Errorf("error closing TFRecord file %s: %w", w.filename, err)
+	}
+	if err := w.fd.Close(); err != nil {
+		return fmt.Errorf("error committing TFRecord file %s: %w", w.filename, err)
+	}
+	emit(w.filename)
+	return nil
+}
+
+// shardTempFiles lists the temporary files whose records make up one shard.
+type shardTempFiles struct {
+	Shard      int
+	ShardCount int
+	TempFiles  []string
+}
+
+// assignTempFilesFn divides all of the temporary files among the shards.
+type assignTempFilesFn struct{}
+
+func (f *assignTempFilesFn) ProcessElement(ctx context.Context, _ int, next func(*string) bool, shardCount int, emit func(shardTempFiles)) error {
+	tempFiles := beamgen.IterToSlice(next)
+	sort.Strings(tempFiles)
+
+	shards := make([]shardTempFiles, shardCount)
+	for i := range shards {
+		shards[i].Shard = i
+		shards[i].ShardCount = shardCount
+	}
+	for i, tempFile := range tempFiles {
+		shards[i%shardCount].TempFiles = append(shards[i%shardCount].TempFiles, tempFile)
+	}
+	for _, shard := range shards {
+		emit(shard)
+	}
+	return nil
+}
+
+// copyTempFilesFn writes the records of a shard's temporary files to a
+// temporary file for the whole shard, one record at a time.
+type copyTempFilesFn struct {
+	Output shardedOutput `json:"output"`
+}
+
+func (w *copyTempFilesFn) ProcessElement(ctx context.Context, shard shardTempFiles, emit func(pendingShard)) error {
+	fs, err := filesystem.New(ctx, w.Output.Prefix)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	shardWriter, err := newShardFileWriter(ctx, fs, w.Output, globalShardID(shard.Shard, shard.ShardCount))
+	if err != nil {
+		return err
+	}
+	log.Infof(ctx, "Writing %d temporary files to %v", len(shard.TempFiles), shardWriter.pending.TempFilename)
+
+	for _, tempFile := range shard.TempFiles {
+		if err := copyRecords(ctx, fs, tempFile, shardWriter); err != nil {
+			shardWriter.Abort()
+			return err
+		}
+	}
+
+	pending, err := shardWriter.Close()
+	if err != nil {
+		return err
+	}
+	emit(pending)
+	return nil
+}
+
+// copyRecords writes every record of a TFRecord file to shardWriter.
+func copyRecords(ctx context.Context, fs filesystem.Interface, filename string, shardWriter *shardFileWriter) error {
+	fd, err := fs.OpenRead(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("error opening %s for reading: %w", filename, err)
+	}
+	defer fd.Close()
+
+	recordReader, err := tfrecord.NewReaderFrom(fd, &tfrecord.RecordReaderOptions{
+		CompressionType: tfrecord.CompressionTypeNone,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating record reader for %s: %w", filename, err)
+	}
+	defer recordReader.Close()
+	for {
+		record, err := recordReader.ReadRecord()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading record %d of %s: %w", recordReader.NumRecordsProduced(), filename, err)
+		}
+		if err := shardWriter.WriteRecord(record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package tfrecordio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWriteModeBundleFiles(t *testing.T) {
+	records := testRecords(500)
+	prefix := "memfs://bundle-mode/out"
+	writeRecords(t, prefix, 3, records, WithWriteMode(WriteModeBundleFiles))
+	checkRead(t, prefix+"-.*", records)
+
+	// The bundle files are temporary files, so only the shards are left.
+	want := []string{prefix + "-00001-of-00003", prefix + "-00002-of-00003", prefix + "-00003-of-00003"}
+	if got := listFiles(t, "memfs://bundle-mode/.*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("files after commit = %q, want %q", got, want)
+	}
+}
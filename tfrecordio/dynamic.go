@@ -0,0 +1,125 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*keyByDestinationFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*keyByDestinationFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*indexDestinationFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*indexDestinationFn)(nil)).Elem())
+
+	runtime.RegisterFunction(destinationPartition)
+}
+
+// Destination is one of the sharded outputs of WriteDynamic.
+type Destination struct {
+	// Prefix is the filename prefix of the destination's shards.
+	Prefix string
+	// ShardCount is the number of shards of the destination. It must be zero
+	// if Options sets a target shard size.
+	ShardCount int
+	// Options are applied after the options passed to WriteDynamic, so they
+	// override them for this destination.
+	Options []WriteOption
+}
+
+// WriteDynamic writes each record of col to the destination named by its key.
+// Each destination is written as if by WriteSharded, so it has its own shard
+// files, temporary directory and, if requested, manifest. Records whose key is
+// not in destinations make the pipeline fail.
+//
+// It returns the ShardInfo of every shard of every destination.
+func WriteDynamic(s beam.Scope, destinations map[string]Destination, col beamgen.Collection[beamgen.KV[string, []byte]], opts ...WriteOption) beamgen.Collection[ShardInfo] {
+	s = s.Scope("tfrecord.WriteDynamic")
+
+	if len(destinations) == 0 {
+		panic(fmt.Errorf("WriteDynamic requires at least one destination"))
+	}
+	var names []string
+	for name := range destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Route every record to its destination in a single pass over col.
+	indexed := beam.ParDo(s.Scope("IndexDestinations"), &indexDestinationFn{Destinations: names}, col.PCollection())
+	partitions := beam.Partition(s, len(names), destinationPartition, indexed)
+
+	var infos []beam.PCollection
+	for i, name := range names {
+		dest := destinations[name]
+		ds := s.Scope(fmt.Sprintf("Destination[%s]", name))
+
+		records := beamgen.AssertType[[]byte](beam.DropKey(ds, partitions[i]))
+		destOpts := append(append([]WriteOption(nil), opts...), dest.Options...)
+		infos = append(infos, WriteSharded(ds, dest.Prefix, dest.ShardCount, records, destOpts...).PCollection())
+	}
+	return beamgen.AssertType[ShardInfo](beam.Flatten(s, infos...))
+}
+
+// WriteDynamicByFunc is like WriteDynamic, but calls destFn to find the name of
+// the destination of each record. destFn must be registered with
+// beam.RegisterFunction so that it can be serialized to the workers.
+func WriteDynamicByFunc(s beam.Scope, destinations map[string]Destination, destFn func(record []byte) string, col beamgen.Collection[[]byte], opts ...WriteOption) beamgen.Collection[ShardInfo] {
+	keyed := beamgen.ParDoKV[[]byte, string, []byte](s.Scope("KeyByDestination"), &keyByDestinationFn{
+		DestFn: beam.EncodedFunc{Fn: reflectx.MakeFunc(destFn)},
+	}, col)
+	return WriteDynamic(s, destinations, keyed, opts...)
+}
+
+type keyByDestinationFn struct {
+	DestFn beam.EncodedFunc `json:"destFn"`
+
+	destFn reflectx.Func1x1
+}
+
+func (f *keyByDestinationFn) Setup() {
+	f.destFn = reflectx.ToFunc1x1(f.DestFn.Fn)
+}
+
+func (f *keyByDestinationFn) ProcessElement(ctx context.Context, record []byte, emit func(string, []byte)) error {
+	emit(f.destFn.Call1x1(record).(string), record)
+	return nil
+}
+
+// indexDestinationFn keys each record by the index of its destination in
+// Destinations, and fails if the destination is unknown, which would otherwise
+// drop the record silently.
+type indexDestinationFn struct {
+	Destinations []string `json:"destinations"`
+
+	index map[string]int
+}
+
+func (f *indexDestinationFn) Setup() {
+	f.index = map[string]int{}
+	for i, name := range f.Destinations {
+		f.index[name] = i
+	}
+}
+
+func (f *indexDestinationFn) ProcessElement(ctx context.Context, destination string, record []byte, emit func(int, []byte)) error {
+	i, ok := f.index[destination]
+	if !ok {
+		return fmt.Errorf("record has unknown destination %q", destination)
+	}
+	emit(i, record)
+	return nil
+}
+
+// destinationPartition partitions records keyed by indexDestinationFn.
+func destinationPartition(index int, _ []byte) int {
+	return index
+}
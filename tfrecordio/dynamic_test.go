@@ -0,0 +1,92 @@
+package tfrecordio
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+)
+
+// languageRecords returns n records for each language, which is the first two
+// bytes of each record.
+func languageRecords(n int, languages ...string) map[string][][]byte {
+	records := map[string][][]byte{}
+	for _, lang := range languages {
+		for i := 0; i < n; i++ {
+			records[lang] = append(records[lang], []byte(fmt.Sprintf("%s record %d", lang, i)))
+		}
+	}
+	return records
+}
+
+func languageOf(record []byte) string {
+	return string(record[:2])
+}
+
+func keyByLanguageFn(record []byte) (string, []byte) {
+	return languageOf(record), record
+}
+
+// languageDestinations writes English records to two shards and French
+// records to one.
+func languageDestinations(prefix string) map[string]Destination {
+	return map[string]Destination{
+		"en": {Prefix: prefix + "/en", ShardCount: 2, Options: []WriteOption{WithSharding(ShardRoundRobin())}},
+		"fr": {Prefix: prefix + "/fr", ShardCount: 1},
+	}
+}
+
+func checkDestinations(t *testing.T, prefix string, records map[string][][]byte) {
+	t.Helper()
+	want := []string{prefix + "/en-00001-of-00002", prefix + "/en-00002-of-00002", prefix + "/fr-00001-of-00001"}
+	if got := listFiles(t, prefix+"/.*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("output files = %q, want %q", got, want)
+	}
+	for lang, recs := range records {
+		checkRead(t, prefix+"/"+lang+"-.*", recs)
+	}
+}
+
+func TestWriteDynamic(t *testing.T) {
+	records := languageRecords(20, "en", "fr")
+	prefix := "memfs://dynamic"
+
+	p, s := beam.NewPipelineWithRoot()
+	col := beamgen.Create(s, append(records["en"], records["fr"]...)...)
+	keyed := beamgen.AssertType[beamgen.KV[string, []byte]](beam.ParDo(s, keyByLanguageFn, col.PCollection()))
+	infos := WriteDynamic(s, languageDestinations(prefix), keyed)
+	passert.Count(s, infos.PCollection(), "shards", 3)
+	if err := ptest.Run(p); err != nil {
+		t.Fatal(err)
+	}
+	checkDestinations(t, prefix, records)
+}
+
+func TestWriteDynamicByFunc(t *testing.T) {
+	records := languageRecords(20, "en", "fr")
+	prefix := "memfs://dynamic-by-func"
+
+	p, s := beam.NewPipelineWithRoot()
+	col := beamgen.Create(s, append(records["en"], records["fr"]...)...)
+	WriteDynamicByFunc(s, languageDestinations(prefix), languageOf, col)
+	if err := ptest.Run(p); err != nil {
+		t.Fatal(err)
+	}
+	checkDestinations(t, prefix, records)
+}
+
+func TestWriteDynamicUnknownDestination(t *testing.T) {
+	records := languageRecords(5, "en", "de")
+
+	p, s := beam.NewPipelineWithRoot()
+	col := beamgen.Create(s, append(records["en"], records["de"]...)...)
+	WriteDynamicByFunc(s, languageDestinations("memfs://dynamic-unknown"), languageOf, col)
+	if err := ptest.Run(p); err == nil || !strings.Contains(err.Error(), `unknown destination "de"`) {
+		t.Errorf("pipeline with records for an unknown destination returned %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/google/uuid"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*finalizeShardsFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*finalizeShardsFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*pendingShard)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*pendingShard)(nil)).Elem())
+}
+
+// pendingShard is a shard that has been written to a temporary file but not
+// yet renamed to its final name, which is Info.Filename.
+type pendingShard struct {
+	TempFilename string
+	Info         ShardInfo
+}
+
+// tempRoot returns the directory that holds the temporary directories of every
+// write to the output with the given prefix. It is a sibling of the output
+// files whose name starts with a dot, so globs of the form prefix + "-*" never
+// match temporary files. The returned name ends with a slash.
+func tempRoot(filenamePrefix string) string {
+	i := strings.LastIndex(filenamePrefix, "/") + 1
+	return filenamePrefix[:i] + ".temp-tfrecordio-" + filenamePrefix[i:] + "/"
+}
+
+// tempDirectory returns a new, unique directory in the temporary root of the
+// output with the given prefix. The returned name ends with a slash.
+func tempDirectory(filenamePrefix string) string {
+	return tempRoot(filenamePrefix) + uuid.NewString() + "/"
+}
+
+// RemoveTempFiles removes the temporary files that writes to the output with
+// the given filename prefix have left behind. Every write uses its own
+// directory inside a directory named ".temp-tfrecordio-" followed by the last
+// element of the prefix, next to the output files. WriteSharded removes its
+// own directory when it commits its output, but a pipeline that fails or is
+// cancelled before then, or one that writes with WriteWindowed, leaves its
+// directory behind.
+//
+// RemoveTempFiles removes the directories of every write to the output, so it
+// must not be called while a pipeline is writing to it, since it would remove
+// shards that haven't been committed yet.
+func RemoveTempFiles(ctx context.Context, filenamePrefix string) error {
+	fs, err := filesystem.New(ctx, filenamePrefix)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	return removeTempRoot(ctx, fs, tempRoot(filenamePrefix))
+}
+
+// tempFilename returns a unique temporary file name in tempDir for a file that
+// will eventually be renamed to finalName. Every call returns a different name
+// so that retried and zombie bundles never write to the same file.
+func tempFilename(tempDir, finalName string) string {
+	return tempDir + baseName(finalName) + "." + uuid.NewString()
+}
+
+// finalizeShards renames the temporary files of all pending shards to their
+// final names once every shard has been written, then removes everything left
+// in the temporary directory of out. Shards that received no records are
+// written as empty files so that the output always has shardCount shards. It
+// returns the ShardInfo of every committed shard.
+func finalizeShards(s beam.Scope, out shardedOutput, shardCount beamgen.Collection[int], pending beamgen.Collection[pendingShard]) beamgen.Collection[ShardInfo] {
+	s = s.Scope("FinalizeShards")
+
+	// Read all of the shards as a side input of a single element so that
+	// nothing is renamed until every shard has been written successfully, and
+	// so that empty shards are written even if there are no pending shards.
+	return beamgen.ParDoUnsafe[[]byte, ShardInfo](s, &finalizeShardsFn{Output: out}, beamgen.AssertType[[]byte](beam.Impulse(s)),
+		beam.SideInput{Input: pending.PCollection()},
+		beam.SideInput{Input: shardCount.PCollection()})
+}
+
+// finalizeShardsFn commits shards by renaming their temporary files. It is
+// safe to retry: shards that were already renamed by a previous attempt are
+// skipped.
+type finalizeShardsFn struct {
+	Output shardedOutput `json:"output"`
+}
+
+func (f *finalizeShardsFn) ProcessElement(ctx context.Context, _ []byte, next func(*pendingShard) bool, shardCount int, emit func(ShardInfo)) error {
+	fs, err := filesystem.New(ctx, f.Output.TempDir)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	committed, err := commitShards(ctx, fs, next)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, info := range committed {
+		seen[info.Filename] = true
+	}
+
+	for shard := 0; shard < shardCount; shard++ {
+		id := globalShardID(shard, shardCount)
+		if seen[f.Output.shardFilename(id)] {
+			continue
+		}
+		info, err := writeEmptyShard(ctx, fs, f.Output, id)
+		if err != nil {
+			return err
+		}
+		committed = append(committed, info)
+	}
+
+	// Other writes to the same output may still be using their own
+	// temporary directories in the same root, so only remove this one.
+	if err := removeTempDir(ctx, fs, f.Output.TempDir); err != nil {
+		log.Warnf(ctx, "Failed to remove temporary files in %v: %v", f.Output.TempDir, err)
+	}
+	for _, info := range committed {
+		emit(info)
+	}
+	return nil
+}
+
+// commitShards commits every pending shard and returns the ShardInfo of each
+// distinct shard.
+func commitShards(ctx context.Context, fs filesystem.Interface, next func(*pendingShard) bool) ([]ShardInfo, error) {
+	var committed []ShardInfo
+	seen := map[string]bool{}
+	err := beamgen.IterForEachErr(next, func(shard pendingShard) error {
+		if seen[shard.Info.Filename] {
+			// Another successful attempt at the same shard; its temporary
+			// file is removed with the other leftovers.
+			return nil
+		}
+		seen[shard.Info.Filename] = true
+		if err := commitShard(ctx, fs, shard); err != nil {
+			return err
+		}
+		committed = append(committed, shard.Info)
+		return nil
+	})
+	return committed, err
+}
+
+// commitShard renames the temporary file of a shard to its final name.
+func commitShard(ctx context.Context, fs filesystem.Interface, shard pendingShard) error {
+	err := filesystem.Rename(ctx, fs, shard.TempFilename, shard.Info.Filename)
+	if err == nil {
+		return nil
+	}
+	// If a previous attempt at finalization already renamed the file, the
+	// temporary file is gone and the final file exists.
+	if _, tempErr := fs.Size(ctx, shard.TempFilename); tempErr != nil {
+		if _, finalErr := fs.Size(ctx, shard.Info.Filename); finalErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("error renaming %s to %s: %w", shard.TempFilename, shard.Info.Filename, err)
+}
+
+// writeEmptyShard writes and commits a shard that has no records.
+func writeEmptyShard(ctx context.Context, fs filesystem.Interface, out shardedOutput, id shardID) (ShardInfo, error) {
+	shardWriter, err := newShardFileWriter(ctx, fs, out, id)
+	if err != nil {
+		return ShardInfo{}, err
+	}
+	pending, err := shardWriter.Close()
+	if err != nil {
+		return ShardInfo{}, err
+	}
+	if err := commitShard(ctx, fs, pending); err != nil {
+		return ShardInfo{}, err
+	}
+	return pending.Info, nil
+}
+
+// removeTempDir removes every file in the temporary directory dir, including
+// the temporary files of failed and zombie bundles, and then the directory
+// itself.
+func removeTempDir(ctx context.Context, fs filesystem.Interface, dir string) error {
+	rm, ok := fs.(filesystem.Remover)
+	if !ok {
+		return fmt.Errorf("filesystem %T can't remove files in %v", fs, dir)
+	}
+	leftovers, err := fs.List(ctx, dir+"*")
+	if err != nil {
+		return fmt.Errorf("error listing temporary files in %v: %w", dir, err)
+	}
+	for _, filename := range leftovers {
+		// Globs don't match exactly on every filesystem, such as memfs,
+		// which treats them as regular expressions.
+		if !strings.HasPrefix(filename, dir) {
+			continue
+		}
+		if err := rm.Remove(ctx, filename); err != nil {
+			return fmt.Errorf("error removing temporary file %v: %w", filename, err)
+		}
+	}
+	// Filesystems without directories have nothing to remove here.
+	rm.Remove(ctx, strings.TrimSuffix(dir, "/"))
+	return nil
+}
+
+// removeTempRoot removes every temporary directory in root with
+// removeTempDir, and then root itself.
+func removeTempRoot(ctx context.Context, fs filesystem.Interface, root string) error {
+	leftovers, err := fs.List(ctx, root+"*/*")
+	if err != nil {
+		return fmt.Errorf("error listing temporary files in %v: %w", root, err)
+	}
+	// Empty directories only show up when listing the root itself, on
+	// filesystems that have directories.
+	if subdirs, err := fs.List(ctx, root+"*"); err == nil {
+		leftovers = append(leftovers, subdirs...)
+	}
+	dirs := map[string]bool{}
+	for _, filename := range leftovers {
+		if !strings.HasPrefix(filename, root) {
+			continue
+		}
+		name := strings.TrimPrefix(filename, root)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		dirs[root+name+"/"] = true
+	}
+	for dir := range dirs {
+		if err := removeTempDir(ctx, fs, dir); err != nil {
+			return err
+		}
+	}
+	if rm, ok := fs.(filesystem.Remover); ok {
+		rm.Remove(ctx, strings.TrimSuffix(root, "/"))
+	}
+	return nil
+}
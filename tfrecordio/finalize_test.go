@@ -0,0 +1,59 @@
+package tfrecordio
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+)
+
+// listFiles returns the files that match glob.
+func listFiles(t *testing.T, glob string) []string {
+	t.Helper()
+	ctx := context.Background()
+	fs, err := filesystem.New(ctx, glob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	files, err := fs.List(ctx, glob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestWriteShardedRemovesOnlyItsTempFiles(t *testing.T) {
+	prefix := "memfs://finalize/out"
+	// The temporary file of another write to the same output, which may
+	// still be running.
+	other := tempDirectory(prefix) + "out-00001-of-00003.abc"
+	memfs.Write(other, []byte("partial"))
+
+	writeRecords(t, prefix, 3, testRecords(10))
+
+	if got, want := listFiles(t, tempRoot(prefix)+".*"), []string{other}; !reflect.DeepEqual(got, want) {
+		t.Errorf("temporary files after commit = %q, want %q", got, want)
+	}
+	want := []string{prefix + "-00001-of-00003", prefix + "-00002-of-00003", prefix + "-00003-of-00003"}
+	if got := listFiles(t, prefix+"-.*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("output files = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	prefix := "memfs://cleanup/out"
+	other := "memfs://cleanup/outer-00000-of-00001"
+	memfs.Write(tempDirectory(prefix)+"a", []byte("a"))
+	memfs.Write(tempDirectory(prefix)+"b", []byte("b"))
+	memfs.Write(other, []byte("other"))
+
+	if err := RemoveTempFiles(context.Background(), prefix); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listFiles(t, "memfs://cleanup/.*"), []string{other}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files after RemoveTempFiles = %q, want %q", got, want)
+	}
+}
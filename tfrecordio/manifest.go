@@ -0,0 +1,202 @@
+package tfrecordio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+	"github.com/google/uuid"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*writeManifestFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*writeManifestFn)(nil)).Elem())
+}
+
+// Manifest lists the shards of the output of WriteSharded, so that consumers
+// can find every shard and its number of records without reading the shards.
+type Manifest struct {
+	// ShardCount is the number of shards in the output.
+	ShardCount int `json:"shardCount"`
+	// RecordCount is the total number of records in all of the shards.
+	RecordCount int64 `json:"recordCount"`
+	// Shards lists every shard, ordered by filename.
+	Shards []ManifestShard `json:"shards"`
+}
+
+// ManifestShard describes one shard in a Manifest.
+//
+// In the manifest file, Filename is relative to the directory that contains
+// the manifest, so the manifest remains valid if the output is moved.
+// ReadManifest resolves it to a full path.
+type ManifestShard struct {
+	ShardInfo
+	// CompressionType is the name TensorFlow uses for the compression type of
+	// the shard, such as "GZIP", or "" if the shard is uncompressed. Snappy
+	// shards are "SNAPPY_FRAMED", since they use the framed Snappy format,
+	// which TensorFlow's "SNAPPY" reader can't read.
+	CompressionType string `json:"compressionType"`
+}
+
+// manifestCompressionType returns the CompressionType of a ManifestShard
+// compressed with ct.
+func manifestCompressionType(ct tfrecord.CompressionType) string {
+	if ct == tfrecord.CompressionTypeSnappy {
+		return "SNAPPY_FRAMED"
+	}
+	return ct.String()
+}
+
+// ManifestFilename returns the name of the manifest that WriteSharded writes
+// for the output with the given prefix when WithManifest is used. The name
+// does not start with prefix + "-", so it doesn't match the glob of shards
+// named with DefaultShardNameTemplate.
+func ManifestFilename(filenamePrefix string) string {
+	return filenamePrefix + ".manifest.json"
+}
+
+// writeManifest writes the manifest of out once all of its shards have been
+// committed.
+func writeManifest(s beam.Scope, out shardedOutput, shardCount beamgen.Collection[int], infos beamgen.Collection[ShardInfo]) {
+	s = s.Scope("WriteManifest")
+
+	grouped := beamgen.GroupByKey(s, beamgen.AddFixedKey(s, infos))
+	beam.ParDo0(s, &writeManifestFn{Output: out}, grouped.PCollection(),
+		beam.SideInput{Input: shardCount.PCollection()})
+}
+
+// writeManifestFn writes the manifest of a sharded output.
+type writeManifestFn struct {
+	Output shardedOutput `json:"output"`
+}
+
+func (w *writeManifestFn) ProcessElement(ctx context.Context, _ int, next func(*ShardInfo) bool, shardCount int) error {
+	manifest := &Manifest{ShardCount: shardCount}
+	for _, info := range beamgen.IterToSlice(next) {
+		ct := w.Output.compressionType(info.Filename)
+		info.Filename = baseName(info.Filename)
+		manifest.RecordCount += info.RecordCount
+		manifest.Shards = append(manifest.Shards, ManifestShard{
+			ShardInfo:       info,
+			CompressionType: manifestCompressionType(ct),
+		})
+	}
+	sort.Slice(manifest.Shards, func(i, j int) bool {
+		return manifest.Shards[i].Filename < manifest.Shards[j].Filename
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filename := ManifestFilename(w.Output.Prefix)
+	fs, err := filesystem.New(ctx, filename)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	// Write to a temporary file first so that the manifest is never
+	// partially written.
+	tempFile := filename + "." + uuid.NewString()
+	if err := filesystem.Write(ctx, fs, tempFile, data); err != nil {
+		return fmt.Errorf("error writing manifest %s: %w", tempFile, err)
+	}
+	if err := filesystem.Rename(ctx, fs, tempFile, filename); err != nil {
+		return fmt.Errorf("error renaming %s to %s: %w", tempFile, filename, err)
+	}
+	log.Infof(ctx, "Wrote manifest of %d shards to %v", len(manifest.Shards), filename)
+	return nil
+}
+
+// ReadManifest reads a manifest written by WriteSharded. The filenames of the
+// returned shards are full paths.
+func ReadManifest(ctx context.Context, filename string) (*Manifest, error) {
+	fs, err := filesystem.New(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.Close()
+
+	data, err := filesystem.Read(ctx, fs, filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %w", filename, err)
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %w", filename, err)
+	}
+
+	dir := filename[:strings.LastIndex(filename, "/")+1]
+	for i := range manifest.Shards {
+		manifest.Shards[i].Filename = dir + manifest.Shards[i].Filename
+	}
+	return manifest, nil
+}
+
+// Verify checks that every shard listed in the manifest exists and has the
+// listed size. If checkContents is true, it also reads every shard and
+// compares its CRC-32C checksum with the manifest.
+func (m *Manifest) Verify(ctx context.Context, checkContents bool) error {
+	if len(m.Shards) != m.ShardCount {
+		return fmt.Errorf("manifest lists %d shards, want %d", len(m.Shards), m.ShardCount)
+	}
+	for _, shard := range m.Shards {
+		if err := verifyShard(ctx, shard.ShardInfo, checkContents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyShard(ctx context.Context, info ShardInfo, checkContents bool) error {
+	fs, err := filesystem.New(ctx, info.Filename)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	size, err := fs.Size(ctx, info.Filename)
+	if err != nil {
+		return fmt.Errorf("shard %s is missing: %w", info.Filename, err)
+	}
+	if size != info.ByteCount {
+		return fmt.Errorf("shard %s is %d bytes, want %d", info.Filename, size, info.ByteCount)
+	}
+	if !checkContents {
+		return nil
+	}
+
+	fd, err := fs.OpenRead(ctx, info.Filename)
+	if err != nil {
+		return fmt.Errorf("error opening %s for reading: %w", info.Filename, err)
+	}
+	defer fd.Close()
+
+	crc := crc32.New(crc32cTable)
+	if _, err := io.Copy(crc, fd); err != nil {
+		return fmt.Errorf("error reading %s: %w", info.Filename, err)
+	}
+	if got := crc.Sum32(); got != info.CRC32C {
+		return fmt.Errorf("shard %s has CRC-32C %08x, want %08x", info.Filename, got, info.CRC32C)
+	}
+	return nil
+}
+
+// baseName returns the last element of a slash-separated path.
+func baseName(filename string) string {
+	return filename[strings.LastIndex(filename, "/")+1:]
+}
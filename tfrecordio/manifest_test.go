@@ -0,0 +1,35 @@
+package tfrecordio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+func TestManifestCompressionType(t *testing.T) {
+	for _, test := range []struct {
+		ct   tfrecord.CompressionType
+		want string
+	}{
+		{tfrecord.CompressionTypeNone, ""},
+		{tfrecord.CompressionTypeGzip, "GZIP"},
+		{tfrecord.CompressionTypeSnappy, "SNAPPY_FRAMED"},
+	} {
+		prefix := "memfs://manifest/" + test.ct.Extension() + "/out"
+		writeRecords(t, prefix, 3, testRecords(10), WithCompression(test.ct), WithManifest())
+
+		m, err := ReadManifest(context.Background(), ManifestFilename(prefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Shards) != 3 {
+			t.Fatalf("manifest of %v shards lists %d shards, want 3", test.ct, len(m.Shards))
+		}
+		for _, shard := range m.Shards {
+			if shard.CompressionType != test.want {
+				t.Errorf("compression type of %v shard %s = %q, want %q", test.ct, shard.Filename, shard.CompressionType, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtosInit registers the DoFns that WriteProtos and ReadProtos use for
+// messages of type T. It must be called from an init function of the pipeline
+// binary for every message type that is written or read.
+func ProtosInit[T proto.Message]() {
+	runtime.RegisterType(reflect.TypeOf((*marshalProtoFn[T])(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*marshalProtoFn[T])(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*unmarshalProtoFn[T])(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*unmarshalProtoFn[T])(nil)).Elem())
+}
+
+// WriteProtos is like WriteSharded, but writes each message of col as a
+// serialized record. Messages are marshaled deterministically, so equal
+// messages are written as equal records.
+func WriteProtos[T proto.Message](s beam.Scope, filenamePrefix string, shardCount int, col beamgen.Collection[T], opts ...WriteOption) beamgen.Collection[ShardInfo] {
+	s = s.Scope("tfrecord.WriteProtos")
+
+	records := beamgen.ParDo1[T, []byte](s, &marshalProtoFn[T]{}, col)
+	return WriteSharded(s, filenamePrefix, shardCount, records, opts...)
+}
+
+// ReadProtos is like Read, but parses every record as a message of type T.
+// Records that can't be parsed are logged, counted in the
+// "proto_parse_failures" counter of the "tfrecordio" namespace, and dropped.
+// Use ReadProtosWithDeadLetter to keep them.
+func ReadProtos[T proto.Message](s beam.Scope, glob string, opts ...ReadOption) beamgen.Collection[T] {
+	msgs, _ := ReadProtosWithDeadLetter[T](s, glob, opts...)
+	return msgs
+}
+
+// ReadProtosWithDeadLetter is like ReadProtos, but also returns the records
+// that couldn't be parsed.
+func ReadProtosWithDeadLetter[T proto.Message](s beam.Scope, glob string, opts ...ReadOption) (beamgen.Collection[T], beamgen.Collection[[]byte]) {
+	s = s.Scope("tfrecord.ReadProtos")
+
+	records := Read(s, glob, opts...)
+	return beamgen.ParDo2[[]byte, T, []byte](s, &unmarshalProtoFn[T]{}, records)
+}
+
+type marshalProtoFn[T proto.Message] struct{}
+
+func (f *marshalProtoFn[T]) ProcessElement(ctx context.Context, msg T, emit func([]byte)) error {
+	record, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling %T: %w", msg, err)
+	}
+	emit(record)
+	return nil
+}
+
+type unmarshalProtoFn[T proto.Message] struct {
+	parseFailures beam.Counter
+}
+
+func (f *unmarshalProtoFn[T]) Setup() {
+	f.parseFailures = beam.NewCounter("tfrecordio", "proto_parse_failures")
+}
+
+func (f *unmarshalProtoFn[T]) ProcessElement(ctx context.Context, record []byte, emit func(T), deadLetter func([]byte)) error {
+	var zero T
+	msg := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(record, msg); err != nil {
+		log.Warnf(ctx, "Failed to parse %d byte record as %T: %v", len(record), msg, err)
+		f.parseFailures.Inc(ctx, 1)
+		deadLetter(record)
+		return nil
+	}
+	emit(msg)
+	return nil
+}
@@ -0,0 +1,61 @@
+package tfrecordio
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func init() {
+	ProtosInit[*wrapperspb.StringValue]()
+}
+
+func stringValueOf(msg *wrapperspb.StringValue) string {
+	return msg.GetValue()
+}
+
+func TestWriteProtosThenReadProtos(t *testing.T) {
+	prefix := "memfs://protos/values"
+	var msgs []*wrapperspb.StringValue
+	var want []any
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("value %d", i)
+		msgs = append(msgs, wrapperspb.String(value))
+		want = append(want, value)
+	}
+	// A record that isn't a valid message, since wire type 7 doesn't exist.
+	garbage := []byte{0x0f, 0x01}
+
+	p, s := beam.NewPipelineWithRoot()
+	WriteProtos(s, prefix, 2, beamgen.Create(s, msgs...))
+	WriteSharded(s, prefix+"-garbage", 1, beamgen.Create(s, garbage))
+	if err := ptest.Run(p); err != nil {
+		t.Fatal(err)
+	}
+
+	p, s = beam.NewPipelineWithRoot()
+	read, deadLetter := ReadProtosWithDeadLetter[*wrapperspb.StringValue](s, prefix+"-.*")
+	passert.Equals(s, beam.ParDo(s, stringValueOf, read.PCollection()), want...)
+	passert.Equals(s, deadLetter.PCollection(), garbage)
+	result, err := ptest.RunWithMetrics(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures int64
+	counters := result.Metrics().Query(func(r metrics.SingleResult) bool {
+		return r.Namespace() == "tfrecordio" && r.Name() == "proto_parse_failures"
+	}).Counters()
+	for _, c := range counters {
+		failures += c.Result()
+	}
+	if failures != 1 {
+		t.Errorf("proto_parse_failures = %d, want 1", failures)
+	}
+}
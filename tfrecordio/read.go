@@ -0,0 +1,372 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/sdf"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/rtrackers/offsetrange"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*expandGlobFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*expandGlobFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*statFileFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*statFileFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*readSdfFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*readSdfFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*fileInfo)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*fileInfo)(nil)).Elem())
+}
+
+// ReadMode selects how Read handles corrupt records.
+type ReadMode int
+
+const (
+	// ReadModeStrict fails the read when a record's length or data checksum
+	// doesn't match. This is the default.
+	ReadModeStrict ReadMode = iota
+
+	// ReadModeSkipCorruption skips corrupt records and continues reading from
+	// the next valid record of the file, as described by
+	// tfrecord.RecordReaderOptions.SkipCorruptRecords. Skipped records and
+	// bytes are counted in the "corrupt_records_skipped" and
+	// "corrupt_bytes_skipped" counters of the "tfrecordio" namespace.
+	ReadModeSkipCorruption
+)
+
+// ReadOption configures Read.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	mode          ReadMode
+	maxRecordSize int64
+}
+
+func newReadOptions(opts []ReadOption) readOptions {
+	var o readOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithReadMode sets how Read handles corrupt records.
+func WithReadMode(mode ReadMode) ReadOption {
+	return func(o *readOptions) { o.mode = mode }
+}
+
+// WithMaxRecordSize makes Read fail on records longer than n bytes instead of
+// allocating memory for them, which protects workers from files with corrupt
+// or hostile record lengths. See tfrecord.RecordReaderOptions.MaxRecordSize.
+func WithMaxRecordSize(n int64) ReadOption {
+	return func(o *readOptions) { o.maxRecordSize = n }
+}
+
+// Read reads the records of every TFRecord file matching glob, which may use
+// any filesystem registered with Beam's filesystem package. The compression
+// type of each file is detected automatically, so Read can read back the
+// output of WriteSharded using a glob such as prefix + "-*".
+//
+// Uncompressed files are read with a splittable DoFn, so large files are
+// split into byte ranges that are read in parallel and runners that support
+// dynamic work rebalancing can split them further while they are read.
+//
+// By default, a corrupt record fails the read. Use WithReadMode to skip
+// corrupt records instead.
+func Read(s beam.Scope, glob string, opts ...ReadOption) beamgen.Collection[[]byte] {
+	s = s.Scope("tfrecord.Read")
+
+	filesystem.ValidateScheme(glob)
+
+	o := newReadOptions(opts)
+
+	files := beamgen.ParDo1[string, string](s.Scope("ExpandGlob"), &expandGlobFn{}, beamgen.Create(s, glob))
+	// Distribute the files across workers before reading them; otherwise a
+	// runner may fuse the expansion and all of the reads into one bundle.
+	files = beamgen.Reshuffle(s.Scope("ReshuffleFiles"), files)
+	infos := beamgen.ParDo1[string, fileInfo](s.Scope("StatFiles"), &statFileFn{}, files)
+	return beamgen.ParDoUnsafe[fileInfo, []byte](s.Scope("ReadFiles"), &readSdfFn{Mode: o.mode, MaxRecordSize: o.maxRecordSize}, infos)
+}
+
+// expandGlobFn emits the name of every file that matches a glob.
+type expandGlobFn struct{}
+
+func (f *expandGlobFn) ProcessElement(ctx context.Context, glob string, emit func(string)) error {
+	if strings.TrimSpace(glob) == "" {
+		return nil
+	}
+
+	fs, err := filesystem.New(ctx, glob)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	files, err := fs.List(ctx, glob)
+	if err != nil {
+		return fmt.Errorf("error expanding glob %q: %w", glob, err)
+	}
+	for _, filename := range files {
+		emit(filename)
+	}
+	return nil
+}
+
+// fileInfo describes a file to be read by readSdfFn.
+type fileInfo struct {
+	Filename string
+	Size     int64
+	// Splittable is true if the file is uncompressed, which means reading can
+	// start from the first record boundary after any byte offset.
+	Splittable bool
+}
+
+// statFileFn emits the size and splittability of a TFRecord file.
+type statFileFn struct{}
+
+func (f *statFileFn) ProcessElement(ctx context.Context, filename string, emit func(fileInfo)) error {
+	fs, err := filesystem.New(ctx, filename)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	size, err := fs.Size(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("error getting size of %s: %w", filename, err)
+	}
+
+	fd, err := fs.OpenRead(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("error opening %s for reading: %w", filename, err)
+	}
+	defer fd.Close()
+
+	header := make([]byte, 12)
+	n, err := io.ReadFull(fd, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("error reading header of %s: %w", filename, err)
+	}
+	ct := tfrecord.DetectCompressionType(header[:n])
+	if ct == tfrecord.CompressionTypeAuto {
+		ct = tfrecord.CompressionTypeFromPath(filename)
+	}
+
+	emit(fileInfo{
+		Filename:   filename,
+		Size:       size,
+		Splittable: ct == tfrecord.CompressionTypeNone,
+	})
+	return nil
+}
+
+// readSdfFn is a splittable DoFn that emits the records of a TFRecord file.
+//
+// The restriction of an uncompressed file is a range of byte offsets, and each
+// record belongs to the restriction that contains its first byte. Reading a
+// restriction starts by scanning forward to the first record boundary, so
+// files can be split at arbitrary offsets, both initially and by dynamic work
+// rebalancing. Compressed files cannot be read from the middle, so they get
+// the single-position restriction [0, 1) that is claimed before reading the
+// whole file.
+type readSdfFn struct {
+	Mode          ReadMode `json:"mode"`
+	MaxRecordSize int64    `json:"maxRecordSize"`
+
+	recordsSkipped beam.Counter
+	bytesSkipped   beam.Counter
+}
+
+const (
+	// blockSize is the desired size of each block for initial splits.
+	blockSize int64 = 64 * 1024 * 1024 // 64 MB
+	// tooSmall is the size limit for a block. If the last block is smaller than
+	// this, it gets merged with the previous block.
+	tooSmall = blockSize / 4
+)
+
+func (f *readSdfFn) Setup() {
+	f.recordsSkipped = beam.NewCounter("tfrecordio", "corrupt_records_skipped")
+	f.bytesSkipped = beam.NewCounter("tfrecordio", "corrupt_bytes_skipped")
+}
+
+// readerOptions returns the options of a record reader for files of
+// compression type ct.
+func (f *readSdfFn) readerOptions(ct tfrecord.CompressionType) *tfrecord.RecordReaderOptions {
+	return &tfrecord.RecordReaderOptions{
+		CompressionType:    ct,
+		SkipCorruptRecords: f.Mode == ReadModeSkipCorruption,
+		MaxRecordSize:      f.MaxRecordSize,
+	}
+}
+
+// readRecord reads the next record and counts any corrupt records that were
+// skipped before it. It returns the number of bytes skipped.
+func (f *readSdfFn) readRecord(ctx context.Context, rr *tfrecord.RecordReader, filename string) ([]byte, int64, error) {
+	records, bytes := rr.NumRecordsSkipped(), rr.NumBytesSkipped()
+	record, err := rr.ReadRecord()
+	skipped := rr.NumBytesSkipped() - bytes
+	if skipped > 0 {
+		log.Warnf(ctx, "Skipped %d corrupt bytes of %s", skipped, filename)
+		f.recordsSkipped.Inc(ctx, int64(rr.NumRecordsSkipped()-records))
+		f.bytesSkipped.Inc(ctx, skipped)
+	}
+	return record, skipped, err
+}
+
+func (f *readSdfFn) CreateInitialRestriction(file fileInfo) offsetrange.Restriction {
+	if !file.Splittable {
+		return offsetrange.Restriction{Start: 0, End: 1}
+	}
+	return offsetrange.Restriction{Start: 0, End: file.Size}
+}
+
+func (f *readSdfFn) SplitRestriction(file fileInfo, rest offsetrange.Restriction) []offsetrange.Restriction {
+	if !file.Splittable {
+		return []offsetrange.Restriction{rest}
+	}
+	splits := rest.SizedSplits(blockSize)
+	numSplits := len(splits)
+	if numSplits > 1 {
+		last := splits[numSplits-1]
+		if last.End-last.Start <= tooSmall {
+			// Last restriction is too small, so merge it with previous one.
+			splits[numSplits-2].End = last.End
+			splits = splits[:numSplits-1]
+		}
+	}
+	return splits
+}
+
+func (f *readSdfFn) RestrictionSize(file fileInfo, rest offsetrange.Restriction) float64 {
+	if !file.Splittable {
+		return float64(file.Size)
+	}
+	return rest.Size()
+}
+
+func (f *readSdfFn) CreateTracker(rest offsetrange.Restriction) *sdf.LockRTracker {
+	return sdf.NewLockRTracker(offsetrange.NewTracker(rest))
+}
+
+func (f *readSdfFn) ProcessElement(ctx context.Context, rt *sdf.LockRTracker, file fileInfo, emit func([]byte)) error {
+	rest := rt.GetRestriction().(offsetrange.Restriction)
+	log.Infof(ctx, "Reading from %v [%d, %d)", file.Filename, rest.Start, rest.End)
+
+	fs, err := filesystem.New(ctx, file.Filename)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	fd, err := fs.OpenRead(ctx, file.Filename)
+	if err != nil {
+		return fmt.Errorf("error opening %s for reading: %w", file.Filename, err)
+	}
+	defer fd.Close()
+
+	if !file.Splittable {
+		if !rt.TryClaim(rest.Start) {
+			return nil
+		}
+		recordReader, err := tfrecord.NewReaderFrom(fd, f.readerOptions(tfrecord.CompressionTypeAuto))
+		if err != nil {
+			return fmt.Errorf("error creating record reader for %s: %w", file.Filename, err)
+		}
+		defer recordReader.Close()
+		for {
+			record, _, err := f.readRecord(ctx, recordReader, file.Filename)
+			if err == io.EOF {
+				// The whole file has been read, so claim the rest of the
+				// restriction to mark it done.
+				rt.TryClaim(rest.End)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error reading record %d of %s: %w", recordReader.NumRecordsProduced(), file.Filename, err)
+			}
+			emit(record)
+		}
+	}
+
+	if err := skipBytes(fd, rest.Start); err != nil {
+		return fmt.Errorf("error seeking to offset %d of %s: %w", rest.Start, file.Filename, err)
+	}
+	// Limiting the reader to the rest of the file lets the record reader
+	// reject record lengths that run past its end.
+	recordReader, err := tfrecord.NewReaderFrom(io.LimitReader(fd, file.Size-rest.Start), f.readerOptions(tfrecord.CompressionTypeNone))
+	if err != nil {
+		return fmt.Errorf("error creating record reader for %s: %w", file.Filename, err)
+	}
+	defer recordReader.Close()
+
+	offset := rest.Start
+	if offset > 0 {
+		// The restriction may start in the middle of a record, so find the
+		// first record header that starts within it. The record is then read
+		// like any other, so that a corrupt record fails the read or is
+		// counted as skipped, depending on the read mode.
+		skipped, err := recordReader.SkipToRecordHeader(rest.End - rest.Start)
+		if err == io.EOF || err == tfrecord.ErrNoRecordBoundary {
+			// No records start in the restriction but it's still valid, so
+			// finish claiming before returning to avoid errors.
+			rt.TryClaim(rt.GetRestriction().(offsetrange.Restriction).End)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error finding first record after offset %d of %s: %w", rest.Start, file.Filename, err)
+		}
+		offset += skipped
+	}
+
+	// Claim each record until we claim a record outside the restriction.
+	for rt.TryClaim(offset) {
+		record, skipped, err := f.readRecord(ctx, recordReader, file.Filename)
+		if err == io.EOF {
+			// Finish claiming restriction before breaking to avoid errors.
+			rt.TryClaim(rt.GetRestriction().(offsetrange.Restriction).End)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading record at offset %d of %s: %w", offset, file.Filename, err)
+		}
+		if skipped > 0 {
+			// The record starts after the skipped bytes, possibly outside of
+			// the restriction, so it must be claimed separately.
+			offset += skipped
+			if !rt.TryClaim(offset) {
+				break
+			}
+		}
+		emit(record)
+		offset += int64(len(record)) + 16
+	}
+	return nil
+}
+
+// skipBytes advances r by n bytes, seeking if possible.
+func skipBytes(r io.Reader, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(n, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
@@ -0,0 +1,143 @@
+package tfrecordio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/sdf"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/rtrackers/offsetrange"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+func TestMain(m *testing.M) {
+	ptest.Main(m)
+}
+
+// testRecords returns n distinct records of varying lengths.
+func testRecords(n int) [][]byte {
+	records := make([][]byte, n)
+	for i := range records {
+		records[i] = []byte(fmt.Sprintf("record %d %0*d", i, i%50, i))
+	}
+	return records
+}
+
+// writeRecords runs a pipeline that writes records with WriteSharded.
+func writeRecords(t *testing.T, filenamePrefix string, shardCount int, records [][]byte, opts ...WriteOption) {
+	t.Helper()
+	p, s := beam.NewPipelineWithRoot()
+	WriteSharded(s, filenamePrefix, shardCount, beamgen.Create(s, records...), opts...)
+	if err := ptest.Run(p); err != nil {
+		t.Fatalf("error writing %s: %v", filenamePrefix, err)
+	}
+}
+
+// checkRead runs a pipeline that reads glob and checks that it produces
+// records, in any order.
+func checkRead(t *testing.T, glob string, records [][]byte) {
+	t.Helper()
+	p, s := beam.NewPipelineWithRoot()
+	want := make([]any, len(records))
+	for i, r := range records {
+		want[i] = r
+	}
+	passert.Equals(s, Read(s, glob).PCollection(), want...)
+	if err := ptest.Run(p); err != nil {
+		t.Fatalf("error reading %s: %v", glob, err)
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	records := testRecords(200)
+	for _, ct := range []tfrecord.CompressionType{
+		tfrecord.CompressionTypeZlib,
+		tfrecord.CompressionTypeGzip,
+		tfrecord.CompressionTypeSnappy,
+		tfrecord.CompressionTypeZstd,
+	} {
+		t.Run(ct.String(), func(t *testing.T) {
+			prefix := "memfs://compressed/" + ct.String() + "/out"
+			writeRecords(t, prefix, 2, records, WithCompression(ct))
+			checkRead(t, prefix+"-.*", records)
+		})
+	}
+}
+
+// encodeRecords returns records in the TFRecord format and the offset of each
+// record.
+func encodeRecords(t *testing.T, records [][]byte) ([]byte, []int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := tfrecord.NewWriterFrom(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int64
+	for _, r := range records {
+		offsets = append(offsets, int64(buf.Len()))
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes(), offsets
+}
+
+// processSplit calls ProcessElement of readSdfFn on the restriction
+// [start, end) of an uncompressed file and returns the records it emits.
+func processSplit(t *testing.T, mode ReadMode, filename string, size, start, end int64) ([][]byte, error) {
+	t.Helper()
+	f := &readSdfFn{Mode: mode}
+	f.Setup()
+	rt := sdf.NewLockRTracker(offsetrange.NewTracker(offsetrange.Restriction{Start: start, End: end}))
+	var got [][]byte
+	err := f.ProcessElement(context.Background(), rt, fileInfo{Filename: filename, Size: size, Splittable: true}, func(r []byte) {
+		got = append(got, r)
+	})
+	if err == nil && !rt.IsDone() {
+		t.Errorf("restriction [%d, %d) isn't done: %v", start, end, rt.GetError())
+	}
+	return got, err
+}
+
+func TestReadSplitStartingBeforeCorruptRecord(t *testing.T) {
+	records := testRecords(10)
+	data, offsets := encodeRecords(t, records)
+	// Corrupt the data checksum of record 3, which is the first record that
+	// starts in a split beginning in the middle of record 2.
+	data[offsets[4]-1] ^= 1
+	filename := "memfs://split/corrupt.tfrecord"
+	memfs.Write(filename, data)
+	size, start := int64(len(data)), offsets[2]+5
+
+	if _, err := processSplit(t, ReadModeStrict, filename, size, start, size); !errors.Is(err, tfrecord.ErrCorruptRecord) {
+		t.Errorf("strict read of split [%d, %d) returned error %v, want %v", start, size, err, tfrecord.ErrCorruptRecord)
+	}
+
+	got, err := processSplit(t, ReadModeSkipCorruption, filename, size, start, size)
+	if err != nil {
+		t.Fatalf("read of split [%d, %d) failed: %v", start, size, err)
+	}
+	if want := records[4:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("read of split [%d, %d) = %q, want %q", start, size, got, want)
+	}
+
+	got, err = processSplit(t, ReadModeStrict, filename, size, 0, start)
+	if err != nil {
+		t.Fatalf("read of split [0, %d) failed: %v", start, err)
+	}
+	if want := records[:3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("read of split [0, %d) = %q, want %q", start, got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*dataSize)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*dataSize)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*measureRecordFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*measureRecordFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*sumDataSizeFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*sumDataSizeFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*computeShardCountFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*computeShardCountFn)(nil)).Elem())
+}
+
+// WithTargetShardBytes makes WriteSharded choose the number of shards at
+// runtime so that each shard holds about n bytes of records. The size of a
+// record is its encoded size in an uncompressed TFRecord file, so compressed
+// shards are smaller than n. WriteSharded must be called with a shardCount of
+// zero.
+func WithTargetShardBytes(n int64) WriteOption {
+	return func(o *writeOptions) { o.targetShardBytes = n }
+}
+
+// WithTargetShardRecords makes WriteSharded choose the number of shards at
+// runtime so that each shard holds about n records. WriteSharded must be
+// called with a shardCount of zero.
+//
+// If WithTargetShardBytes is also used, the shard count is large enough to
+// meet both targets.
+func WithTargetShardRecords(n int64) WriteOption {
+	return func(o *writeOptions) { o.targetShardRecords = n }
+}
+
+// shardCountFor returns a singleton collection that holds the number of shards
+// to write, either shardCount or a count derived from the size of col.
+func shardCountFor(s beam.Scope, shardCount int, o writeOptions, col beamgen.Collection[[]byte]) beamgen.Collection[int] {
+	auto := o.targetShardBytes > 0 || o.targetShardRecords > 0
+	switch {
+	case o.targetShardBytes < 0 || o.targetShardRecords < 0:
+		panic(fmt.Errorf("invalid target shard size: %d bytes, %d records", o.targetShardBytes, o.targetShardRecords))
+	case auto && shardCount != 0:
+		panic(fmt.Errorf("shardCount must be 0 when a target shard size is set, got %d", shardCount))
+	case !auto && shardCount <= 0:
+		panic(fmt.Errorf("invalid shardCount %d <= 0", shardCount))
+	case !auto:
+		return beamgen.Create(s, shardCount)
+	}
+
+	s = s.Scope("ComputeShardCount")
+
+	sizes := beamgen.ParDo1[[]byte, dataSize](s, &measureRecordFn{}, col)
+	// Add an empty size so that the sum exists even if col is empty.
+	sizes = beamgen.AssertType[dataSize](beam.Flatten(s, sizes.PCollection(), beamgen.Create(s, dataSize{}).PCollection()))
+	total := beamgen.AssertType[dataSize](beam.Combine(s, &sumDataSizeFn{}, sizes.PCollection()))
+
+	return beamgen.ParDo1[dataSize, int](s, &computeShardCountFn{
+		TargetShardBytes:   o.targetShardBytes,
+		TargetShardRecords: o.targetShardRecords,
+	}, total)
+}
+
+// dataSize is the size of some records.
+type dataSize struct {
+	Records int64
+	Bytes   int64
+}
+
+type measureRecordFn struct{}
+
+func (f *measureRecordFn) ProcessElement(ctx context.Context, record []byte, emit func(dataSize)) error {
+	// Each record has a 12 byte header and a 4 byte footer.
+	emit(dataSize{Records: 1, Bytes: int64(len(record)) + 16})
+	return nil
+}
+
+type sumDataSizeFn struct{}
+
+func (f *sumDataSizeFn) MergeAccumulators(a, b dataSize) dataSize {
+	return dataSize{Records: a.Records + b.Records, Bytes: a.Bytes + b.Bytes}
+}
+
+type computeShardCountFn struct {
+	TargetShardBytes   int64 `json:"targetShardBytes"`
+	TargetShardRecords int64 `json:"targetShardRecords"`
+}
+
+func (f *computeShardCountFn) ProcessElement(ctx context.Context, total dataSize, emit func(int)) error {
+	shardCount := int64(1)
+	if f.TargetShardBytes > 0 {
+		shardCount = max64(shardCount, ceilDiv(total.Bytes, f.TargetShardBytes))
+	}
+	if f.TargetShardRecords > 0 {
+		shardCount = max64(shardCount, ceilDiv(total.Records, f.TargetShardRecords))
+	}
+	emit(int(shardCount))
+	return nil
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
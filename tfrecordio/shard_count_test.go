@@ -0,0 +1,92 @@
+package tfrecordio
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+)
+
+// shardFiles returns the names of the shards of prefix written with the
+// default shard name template.
+func shardFiles(prefix string, shardCount int) []string {
+	var files []string
+	for i := 1; i <= shardCount; i++ {
+		files = append(files, fmt.Sprintf("%s-%05d-of-%05d", prefix, i, shardCount))
+	}
+	return files
+}
+
+func TestTargetShardSize(t *testing.T) {
+	records := testRecords(250)
+	var totalBytes int64
+	for _, r := range records {
+		totalBytes += int64(len(r)) + 16
+	}
+
+	tests := []struct {
+		name string
+		opts []WriteOption
+		want int
+	}{
+		{"records", []WriteOption{WithTargetShardRecords(100)}, 3},
+		{"exact-records", []WriteOption{WithTargetShardRecords(50)}, 5},
+		{"bytes", []WriteOption{WithTargetShardBytes(totalBytes/3 + 1)}, 3},
+		{"large-target", []WriteOption{WithTargetShardBytes(totalBytes * 10)}, 1},
+		{"both-records", []WriteOption{WithTargetShardBytes(totalBytes), WithTargetShardRecords(60)}, 5},
+		{"both-bytes", []WriteOption{WithTargetShardBytes(totalBytes/4 + 1), WithTargetShardRecords(250)}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := "memfs://shard-count/" + tt.name
+			writeRecords(t, prefix, 0, records, tt.opts...)
+			if got, want := listFiles(t, prefix+"-.*"), shardFiles(prefix, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("output files = %q, want %q", got, want)
+			}
+			checkRead(t, prefix+"-.*", records)
+		})
+	}
+}
+
+func TestTargetShardSizeEmptyInput(t *testing.T) {
+	prefix := "memfs://shard-count/empty"
+	p, s := beam.NewPipelineWithRoot()
+	col := beamgen.AssertType[[]byte](beam.CreateList(s, [][]byte{}))
+	WriteSharded(s, prefix, 0, col, WithTargetShardRecords(100))
+	if err := ptest.Run(p); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listFiles(t, prefix+"-.*"), shardFiles(prefix, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("output files = %q, want %q", got, want)
+	}
+	checkRead(t, prefix+"-.*", nil)
+}
+
+func TestShardCountPanics(t *testing.T) {
+	tests := []struct {
+		name       string
+		shardCount int
+		opts       []WriteOption
+	}{
+		{"zero-shards", 0, nil},
+		{"negative-shards", -1, nil},
+		{"shards-and-target-bytes", 3, []WriteOption{WithTargetShardBytes(1 << 20)}},
+		{"shards-and-target-records", 3, []WriteOption{WithTargetShardRecords(100)}},
+		{"negative-target-bytes", 0, []WriteOption{WithTargetShardBytes(-1)}},
+		{"negative-target-records", 0, []WriteOption{WithTargetShardBytes(1 << 20), WithTargetShardRecords(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WriteSharded with shardCount %d didn't panic", tt.shardCount)
+				}
+			}()
+			_, s := beam.NewPipelineWithRoot()
+			WriteSharded(s, "memfs://shard-count/panic", tt.shardCount, beamgen.Create(s, []byte("record")), tt.opts...)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"reflect"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*ShardInfo)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*ShardInfo)(nil)).Elem())
+}
+
+// ShardInfo describes a shard file that has been written and committed under
+// its final name.
+type ShardInfo struct {
+	// Filename is the final name of the shard file.
+	Filename string `json:"filename"`
+	// RecordCount is the number of records in the shard.
+	RecordCount int64 `json:"recordCount"`
+	// ByteCount is the size of the shard file in bytes.
+	ByteCount int64 `json:"byteCount"`
+	// CRC32C is the CRC-32C (Castagnoli) checksum of the contents of the
+	// shard file, which is the checksum Google Cloud Storage reports for
+	// objects.
+	CRC32C uint32 `json:"crc32c"`
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// shardFileWriter writes the records of a shard to a new temporary file and
+// keeps track of the metadata that is reported in the shard's ShardInfo.
+type shardFileWriter struct {
+	fd           io.WriteCloser
+	recordWriter *tfrecord.RecordWriter
+	crc          hash.Hash32
+	byteCount    int64
+	pending      pendingShard
+}
+
+// newShardFileWriter opens a new temporary file for one shard of out.
+func newShardFileWriter(ctx context.Context, fs filesystem.Interface, out shardedOutput, id shardID) (*shardFileWriter, error) {
+	finalName := out.shardFilename(id)
+	filename := tempFilename(out.TempDir, finalName)
+	fd, err := fs.OpenWrite(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s for writing: %w", filename, err)
+	}
+
+	w := &shardFileWriter{
+		fd:  fd,
+		crc: crc32.New(crc32cTable),
+		pending: pendingShard{
+			TempFilename: filename,
+			Info:         ShardInfo{Filename: finalName},
+		},
+	}
+	w.recordWriter, err = tfrecord.NewWriterFrom(w, &tfrecord.RecordWriterOptions{
+		CompressionType: out.compressionType(finalName),
+	})
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("error creating record writer: %w", err)
+	}
+	return w, nil
+}
+
+// Write implements io.Writer for the record writer.
+func (w *shardFileWriter) Write(p []byte) (int, error) {
+	n, err := w.fd.Write(p)
+	w.crc.Write(p[:n])
+	w.byteCount += int64(n)
+	return n, err
+}
+
+// WriteRecord writes one record to the shard.
+func (w *shardFileWriter) WriteRecord(record []byte) error {
+	if err := w.recordWriter.WriteRecord(record); err != nil {
+		return fmt.Errorf("error writing record to %s: %w", w.pending.TempFilename, err)
+	}
+	return nil
+}
+
+// Close finishes the temporary file and returns the shard to be committed.
+func (w *shardFileWriter) Close() (pendingShard, error) {
+	if err := w.recordWriter.Close(); err != nil {
+		w.fd.Close()
+		return pendingShard{}, fmt.Errorf("error closing TFRecord file: %w", err)
+	}
+	// Closing fd commits the file on filesystems such as gcs and memfs.
+	if err := w.fd.Close(); err != nil {
+		return pendingShard{}, fmt.Errorf("error committing TFRecord file %s: %w", w.pending.TempFilename, err)
+	}
+
+	w.pending.Info.RecordCount = int64(w.recordWriter.NumRecordsWritten())
+	w.pending.Info.ByteCount = w.byteCount
+	w.pending.Info.CRC32C = w.crc.Sum32()
+	return w.pending, nil
+}
+
+// Abort closes the temporary file of a shard that couldn't be written, so that
+// neither its handle nor the record writer's resources are leaked. Errors are
+// ignored, since the shard has already failed; the partial file is removed
+// with the rest of the temporary directory.
+func (w *shardFileWriter) Abort() {
+	w.recordWriter.Close()
+	w.fd.Close()
+}
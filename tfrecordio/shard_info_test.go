@@ -0,0 +1,75 @@
+package tfrecordio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+// checkShardInfoFn fails if a ShardInfo doesn't describe the file it names.
+func checkShardInfoFn(ctx context.Context, info ShardInfo) error {
+	fs, err := filesystem.New(ctx, info.Filename)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	data, err := filesystem.Read(ctx, fs, info.Filename)
+	if err != nil {
+		return err
+	}
+	if got := int64(len(data)); got != info.ByteCount {
+		return fmt.Errorf("%s has %d bytes, but its ShardInfo has ByteCount %d", info.Filename, got, info.ByteCount)
+	}
+	if got := crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)); got != info.CRC32C {
+		return fmt.Errorf("%s has CRC-32C %#x, but its ShardInfo has CRC32C %#x", info.Filename, got, info.CRC32C)
+	}
+	rr, err := tfrecord.NewReaderFrom(bytes.NewReader(data), &tfrecord.RecordReaderOptions{CompressionType: tfrecord.CompressionTypeAuto})
+	if err != nil {
+		return err
+	}
+	var n int64
+	for {
+		if _, err := rr.ReadRecord(); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error reading %s: %w", info.Filename, err)
+		}
+		n++
+	}
+	if n != info.RecordCount {
+		return fmt.Errorf("%s has %d records, but its ShardInfo has RecordCount %d", info.Filename, n, info.RecordCount)
+	}
+	return nil
+}
+
+func TestWriteShardedShardInfo(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts []WriteOption
+	}{
+		{"uncompressed", nil},
+		{"gzip", []WriteOption{WithCompression(tfrecord.CompressionTypeGzip)}},
+		{"bundle files", []WriteOption{WithWriteMode(WriteModeBundleFiles)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, s := beam.NewPipelineWithRoot()
+			// Four shards for 3 records leave at least one shard empty.
+			infos := WriteSharded(s, "memfs://shard-info/"+test.name+"/out", 4, beamgen.Create(s, testRecords(3)...), test.opts...)
+			passert.Count(s, infos.PCollection(), "shards", 4)
+			beam.ParDo0(s, checkShardInfoFn, infos.PCollection())
+			if err := ptest.Run(p); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package tfrecordio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+// ShardNameTemplate describes how the names of shard files are built from the
+// filename prefix passed to WriteSharded.
+//
+// For example, the template
+//
+//	ShardNameTemplate{
+//		Template:             "-SSSSS-of-NNNNN",
+//		Suffix:               ".tfrecord",
+//		CompressionExtension: true,
+//	}
+//
+// names the third of 128 gzip-compressed shards with prefix "train"
+// "train-00003-of-00128.tfrecord.gz".
+type ShardNameTemplate struct {
+	// Template is appended to the prefix. Each run of 'S' characters is
+	// replaced by the shard index and each run of 'N' characters by the number
+	// of shards, zero-padded to the length of the run. Each run of 'W'
+	// characters is replaced by the bounds of the shard's window, such as
+	// "20220601T100000Z-20220601T110000Z", and each run of 'P' characters by
+	// its pane, such as "pane-0" or "pane-2-last". Other characters are copied
+	// as they are. The template must contain a run of 'S' characters so that
+	// every shard has a different name, and templates for WriteWindowed must
+	// also contain 'W' and 'P'. If Template is empty, the default template of
+	// the write transform is used.
+	Template string `json:"template"`
+
+	// ZeroBased numbers shards from 0 instead of from 1.
+	ZeroBased bool `json:"zeroBased"`
+
+	// Suffix is appended after the template, such as ".tfrecord".
+	Suffix string `json:"suffix"`
+
+	// CompressionExtension appends the extension of the compression type of
+	// the shards, such as ".gz", after the suffix. Nothing is appended for
+	// uncompressed shards or for tfrecord.CompressionTypeAuto, which infers
+	// the compression type from the suffix instead.
+	CompressionExtension bool `json:"compressionExtension"`
+}
+
+// DefaultShardNameTemplate is the ShardNameTemplate that WriteSharded uses
+// unless WithShardNameTemplate is given. It names shards like
+// "prefix-00001-of-00005".
+var DefaultShardNameTemplate = ShardNameTemplate{Template: "-SSSSS-of-NNNNN"}
+
+// DefaultWindowedShardNameTemplate is the ShardNameTemplate that WriteWindowed
+// uses unless WithShardNameTemplate is given. It names shards like
+// "prefix-20220601T100000Z-20220601T110000Z-pane-0-last-00001-of-00005".
+var DefaultWindowedShardNameTemplate = ShardNameTemplate{Template: "-W-P-SSSSS-of-NNNNN"}
+
+// WithShardNameTemplate sets how WriteSharded and WriteWindowed name the shard
+// files. The defaults are DefaultShardNameTemplate and
+// DefaultWindowedShardNameTemplate.
+func WithShardNameTemplate(template ShardNameTemplate) WriteOption {
+	return func(o *writeOptions) { o.shardName = template }
+}
+
+// Filename returns the name of a shard of the output with the given prefix.
+// Shards are numbered from zero regardless of t.ZeroBased. The shard is in
+// the global window.
+func (t ShardNameTemplate) Filename(filenamePrefix string, shard, shardCount int, ct tfrecord.CompressionType) string {
+	return t.filename(filenamePrefix, globalShardID(shard, shardCount), ct)
+}
+
+// shardID identifies a shard of the output of one window and pane.
+type shardID struct {
+	Shard      int
+	ShardCount int
+	// Window and Pane are formatted as in filenames.
+	Window string
+	Pane   string
+}
+
+// globalShardID returns the ID of a shard in the global window, which has a
+// single pane.
+func globalShardID(shard, shardCount int) shardID {
+	return shardID{
+		Shard:      shard,
+		ShardCount: shardCount,
+		Window:     windowName(window.GlobalWindow{}),
+		Pane:       paneName(typex.PaneInfo{IsFirst: true, IsLast: true}),
+	}
+}
+
+func (t ShardNameTemplate) filename(filenamePrefix string, id shardID, ct tfrecord.CompressionType) string {
+	index := id.Shard + 1
+	if t.ZeroBased {
+		index = id.Shard
+	}
+	return t.expand(filenamePrefix, ct, func(placeholder rune, width int) string {
+		switch placeholder {
+		case 'S':
+			return fmt.Sprintf("%0*d", width, index)
+		case 'N':
+			return fmt.Sprintf("%0*d", width, id.ShardCount)
+		case 'W':
+			return id.Window
+		default:
+			return id.Pane
+		}
+	})
+}
+
+// windowName formats a window for use in filenames.
+func windowName(w typex.Window) string {
+	switch w := w.(type) {
+	case window.IntervalWindow:
+		const layout = "20060102T150405Z"
+		return w.Start.ToTime().UTC().Format(layout) + "-" + w.End.ToTime().UTC().Format(layout)
+	case window.GlobalWindow:
+		return "global"
+	default:
+		return fmt.Sprintf("window-%d", w.MaxTimestamp().Milliseconds())
+	}
+}
+
+// paneName formats a pane for use in filenames.
+func paneName(pane typex.PaneInfo) string {
+	name := fmt.Sprintf("pane-%d", pane.Index)
+	if pane.IsLast {
+		name += "-last"
+	}
+	return name
+}
+
+// Glob returns a glob that matches the names of all of the shards of the
+// output with the given prefix, for use with Read.
+func (t ShardNameTemplate) Glob(filenamePrefix string, ct tfrecord.CompressionType) string {
+	return t.expand(filenamePrefix, ct, func(rune, int) string { return "*" })
+}
+
+// expand builds a name from the template, replacing each run of placeholder
+// characters with the result of replace.
+func (t ShardNameTemplate) expand(filenamePrefix string, ct tfrecord.CompressionType, replace func(placeholder rune, width int) string) string {
+	template := t.template()
+
+	var b strings.Builder
+	b.WriteString(filenamePrefix)
+	for i := 0; i < len(template); {
+		c := template[i]
+		if !strings.ContainsRune("SNWP", rune(c)) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		width := 1
+		for i+width < len(template) && template[i+width] == c {
+			width++
+		}
+		b.WriteString(replace(rune(c), width))
+		i += width
+	}
+	b.WriteString(t.Suffix)
+	if t.CompressionExtension {
+		b.WriteString(ct.Extension())
+	}
+	return b.String()
+}
+
+func (t ShardNameTemplate) template() string {
+	if t.Template == "" {
+		return DefaultShardNameTemplate.Template
+	}
+	return t.Template
+}
+
+// validate returns an error if shards named with t may have the same name.
+// Shards of windowed output must also be named by window and pane.
+func (t ShardNameTemplate) validate(windowed bool) error {
+	placeholders := "S"
+	if windowed {
+		placeholders = "SWP"
+	}
+	for _, c := range placeholders {
+		if !strings.ContainsRune(t.template(), c) {
+			return fmt.Errorf("shard name template %q has no %q placeholder", t.template(), c)
+		}
+	}
+	return nil
+}
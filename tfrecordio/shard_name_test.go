@@ -0,0 +1,122 @@
+package tfrecordio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	_ "github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/local"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+func TestShardNameTemplateFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		template ShardNameTemplate
+		ct       tfrecord.CompressionType
+		want     string
+		wantGlob string
+	}{
+		{"default", DefaultShardNameTemplate, tfrecord.CompressionTypeGzip, "out-00003-of-00012", "out-*-of-*"},
+		{"empty", ShardNameTemplate{}, tfrecord.CompressionTypeNone, "out-00003-of-00012", "out-*-of-*"},
+		{"zero-based", ShardNameTemplate{Template: "-SSSSS-of-NNNNN", ZeroBased: true}, tfrecord.CompressionTypeNone, "out-00002-of-00012", "out-*-of-*"},
+		{"narrow", ShardNameTemplate{Template: "_S_N"}, tfrecord.CompressionTypeNone, "out_3_12", "out_*_*"},
+		{"suffix", ShardNameTemplate{Template: "-SSS", Suffix: ".tfrecord"}, tfrecord.CompressionTypeGzip, "out-003.tfrecord", "out-*.tfrecord"},
+		{"extension", ShardNameTemplate{Template: "-SSS", Suffix: ".tfrecord", CompressionExtension: true}, tfrecord.CompressionTypeGzip, "out-003.tfrecord.gz", "out-*.tfrecord.gz"},
+		{"extension-none", ShardNameTemplate{Template: "-SSS", Suffix: ".tfrecord", CompressionExtension: true}, tfrecord.CompressionTypeNone, "out-003.tfrecord", "out-*.tfrecord"},
+		{"extension-auto", ShardNameTemplate{Template: "-SSS", Suffix: ".tfrecord.zst", CompressionExtension: true}, tfrecord.CompressionTypeAuto, "out-003.tfrecord.zst", "out-*.tfrecord.zst"},
+		{"windowed", DefaultWindowedShardNameTemplate, tfrecord.CompressionTypeNone, "out-global-pane-0-last-00003-of-00012", "out-*-*-*-of-*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.template.Filename("out", 2, 12, tt.ct)
+			if got != tt.want {
+				t.Errorf("Filename = %q, want %q", got, tt.want)
+			}
+			glob := tt.template.Glob("out", tt.ct)
+			if glob != tt.wantGlob {
+				t.Errorf("Glob = %q, want %q", glob, tt.wantGlob)
+			}
+			if ok, err := filepath.Match(glob, got); err != nil || !ok {
+				t.Errorf("Glob %q doesn't match Filename %q", glob, got)
+			}
+		})
+	}
+}
+
+func TestShardNameTemplateValidate(t *testing.T) {
+	tests := []struct {
+		template       ShardNameTemplate
+		ok, okWindowed bool
+	}{
+		{DefaultShardNameTemplate, true, false},
+		{DefaultWindowedShardNameTemplate, true, true},
+		{ShardNameTemplate{Template: "-of-NNNNN"}, false, false},
+		{ShardNameTemplate{Template: "-W-SSSSS"}, true, false},
+		{ShardNameTemplate{Template: "-P-SSSSS"}, true, false},
+		{ShardNameTemplate{Template: "-W-P"}, false, false},
+	}
+	for _, tt := range tests {
+		if err := tt.template.validate(false); (err == nil) != tt.ok {
+			t.Errorf("validate(false) of %q returned %v", tt.template.Template, err)
+		}
+		if err := tt.template.validate(true); (err == nil) != tt.okWindowed {
+			t.Errorf("validate(true) of %q returned %v", tt.template.Template, err)
+		}
+	}
+}
+
+func TestWriteInvalidShardNameTemplatePanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(beam.Scope, string, int, beamgen.Collection[[]byte], ...WriteOption) beamgen.Collection[ShardInfo]
+		opt   WriteOption
+	}{
+		{"sharded", WriteSharded, WithShardNameTemplate(ShardNameTemplate{Template: "-of-NNNNN"})},
+		{"windowed", WriteWindowed, WithShardNameTemplate(DefaultShardNameTemplate)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("write with an invalid shard name template didn't panic")
+				}
+			}()
+			_, s := beam.NewPipelineWithRoot()
+			tt.write(s, "memfs://shard-name/panic", 2, beamgen.Create(s, []byte("record")), tt.opt)
+		})
+	}
+}
+
+func TestWriteShardNameTemplateThenReadGlob(t *testing.T) {
+	records := testRecords(100)
+	prefix := filepath.Join(t.TempDir(), "train")
+	template := ShardNameTemplate{
+		Template:             "_part-SSS_of_NNN",
+		ZeroBased:            true,
+		Suffix:               ".tfrecord",
+		CompressionExtension: true,
+	}
+	writeRecords(t, prefix, 3, records, WithShardNameTemplate(template), WithCompression(tfrecord.CompressionTypeGzip))
+
+	entries, err := os.ReadDir(filepath.Dir(prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		// Skip the root of the temporary directories, which other writes to
+		// the same output may share.
+		if !e.IsDir() {
+			got = append(got, e.Name())
+		}
+	}
+	want := []string{"train_part-000_of_003.tfrecord.gz", "train_part-001_of_003.tfrecord.gz", "train_part-002_of_003.tfrecord.gz"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("output files = %q, want %q", got, want)
+	}
+	checkRead(t, template.Glob(prefix, tfrecord.CompressionTypeGzip), records)
+}
@@ -0,0 +1,204 @@
+package tfrecordio
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*assignShardNumberFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*assignShardNumberFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*assignShardRoundRobinFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*assignShardRoundRobinFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*assignShardRandomlyFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*assignShardRandomlyFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*assignShardByKeyFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*assignShardByKeyFn)(nil)).Elem())
+}
+
+// ShardingStrategy decides which shard each record is written to when
+// WriteSharded uses WriteModeGroupByShard. Use WithSharding to select one.
+// WriteModeBundleFiles always assigns whole bundle files to shards in turn.
+type ShardingStrategy interface {
+	// assignShardFn returns a DoFn that keys every record by its shard. The
+	// DoFn's ProcessElement method has the signature
+	//
+	//	func(ctx context.Context, record []byte, shardCount int, emit func(int, []byte)) error
+	//
+	// where shardCount is a side input.
+	assignShardFn() any
+}
+
+// WithSharding sets how WriteSharded assigns records to shards. The default is
+// ShardByContentHash.
+func WithSharding(strategy ShardingStrategy) WriteOption {
+	return func(o *writeOptions) { o.sharding = strategy }
+}
+
+// ShardByContentHash assigns each record to a shard by hashing its contents.
+// The assignment is deterministic, but hashing large records is expensive and
+// every copy of a duplicated record is written to the same shard.
+func ShardByContentHash() ShardingStrategy {
+	return contentHashSharding{}
+}
+
+// ShardRoundRobin assigns the records of each bundle to the shards in turn,
+// starting from a random shard in every bundle. It is cheap and spreads
+// duplicate records evenly, but the assignment depends on how the runner
+// divides the input into bundles.
+func ShardRoundRobin() ShardingStrategy {
+	return roundRobinSharding{}
+}
+
+// ShardRandomly assigns each record to a shard chosen uniformly at random. Each
+// bundle draws from a random number generator seeded with seed and the
+// contents of the bundle's first record, so bundles that start with different
+// records draw different sequences. The assignment is reproducible if the
+// runner divides the input into the same bundles, with their records in the
+// same order, no matter which workers process them.
+func ShardRandomly(seed int64) ShardingStrategy {
+	return randomSharding{seed: seed}
+}
+
+// ShardByKey assigns each record to a shard by hashing the key that keyFn
+// returns for it, so that records with equal keys are written to the same
+// shard. keyFn must be registered with beam.RegisterFunction so that it can be
+// serialized to the workers.
+func ShardByKey(keyFn func(record []byte) []byte) ShardingStrategy {
+	return keySharding{keyFn: keyFn}
+}
+
+type contentHashSharding struct{}
+
+func (contentHashSharding) assignShardFn() any {
+	return &assignShardNumberFn{}
+}
+
+type roundRobinSharding struct{}
+
+func (roundRobinSharding) assignShardFn() any {
+	return &assignShardRoundRobinFn{}
+}
+
+type randomSharding struct {
+	seed int64
+}
+
+func (r randomSharding) assignShardFn() any {
+	return &assignShardRandomlyFn{Seed: r.seed}
+}
+
+type keySharding struct {
+	keyFn func(record []byte) []byte
+}
+
+func (k keySharding) assignShardFn() any {
+	return &assignShardByKeyFn{KeyFn: beam.EncodedFunc{Fn: reflectx.MakeFunc(k.keyFn)}}
+}
+
+func shardNum(data []byte, shardCount int) int {
+	h := fnv.New32a()
+	h.Write(data)
+	// The low bits of an FNV hash only depend on the low bits of the data,
+	// so records that only differ in their high bits would all land in the
+	// same shards. Mix the bits, then scale the hash to the shard count.
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return int(uint64(x) * uint64(shardCount) >> 32)
+}
+
+type assignShardNumberFn struct{}
+
+func (f *assignShardNumberFn) ProcessElement(ctx context.Context, record []byte, shardCount int, emit func(int, []byte)) error {
+	emit(shardNum(record, shardCount), record)
+	return nil
+}
+
+type assignShardRoundRobinFn struct {
+	next int
+	rng  *rand.Rand
+}
+
+func (f *assignShardRoundRobinFn) Setup() {
+	f.rng = rand.New(rand.NewSource(randomSeed()))
+}
+
+func (f *assignShardRoundRobinFn) StartBundle(ctx context.Context, shardCount int, emit func(int, []byte)) {
+	// Start each bundle at a different shard so that small bundles don't all
+	// write to the first shards.
+	f.next = f.rng.Intn(shardCount)
+}
+
+func (f *assignShardRoundRobinFn) ProcessElement(ctx context.Context, record []byte, shardCount int, emit func(int, []byte)) error {
+	emit(f.next, record)
+	f.next = (f.next + 1) % shardCount
+	return nil
+}
+
+// randomSeed returns a seed that differs between DoFn instances, even on
+// workers that start at the same time. The global source of math/rand can't
+// be used, since it always starts from the same seed before Go 1.20.
+func randomSeed() int64 {
+	var bs [8]byte
+	if _, err := cryptorand.Read(bs[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(bs[:]))
+}
+
+type assignShardRandomlyFn struct {
+	Seed int64 `json:"seed"`
+
+	// rng is nil until the first record of a bundle.
+	rng *rand.Rand
+}
+
+func (f *assignShardRandomlyFn) StartBundle(ctx context.Context, shardCount int, emit func(int, []byte)) {
+	f.rng = nil
+}
+
+func (f *assignShardRandomlyFn) ProcessElement(ctx context.Context, record []byte, shardCount int, emit func(int, []byte)) error {
+	if f.rng == nil {
+		// Seeding every bundle with Seed alone would make all of them draw
+		// the same sequence, so that small bundles all write to the same
+		// shards.
+		h := fnv.New64a()
+		h.Write(record)
+		f.rng = rand.New(rand.NewSource(f.Seed ^ int64(h.Sum64())))
+	}
+	emit(f.rng.Intn(shardCount), record)
+	return nil
+}
+
+type assignShardByKeyFn struct {
+	KeyFn beam.EncodedFunc `json:"keyFn"`
+
+	keyFn reflectx.Func1x1
+}
+
+func (f *assignShardByKeyFn) Setup() {
+	f.keyFn = reflectx.ToFunc1x1(f.KeyFn.Fn)
+}
+
+func (f *assignShardByKeyFn) ProcessElement(ctx context.Context, record []byte, shardCount int, emit func(int, []byte)) error {
+	key := f.keyFn.Call1x1(record).([]byte)
+	emit(shardNum(key, shardCount), record)
+	return nil
+}
@@ -0,0 +1,172 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfrecord"
+)
+
+// assignShards runs the DoFn of strategy over bundles of records and returns
+// the shard of each record, in order.
+func assignShards(strategy ShardingStrategy, shardCount int, bundles ...[][]byte) []int {
+	fn := strategy.assignShardFn()
+	if s, ok := fn.(interface{ Setup() }); ok {
+		s.Setup()
+	}
+	var shards []int
+	emit := func(shard int, _ []byte) { shards = append(shards, shard) }
+	for _, bundle := range bundles {
+		if s, ok := fn.(interface {
+			StartBundle(context.Context, int, func(int, []byte))
+		}); ok {
+			s.StartBundle(context.Background(), shardCount, emit)
+		}
+		for _, record := range bundle {
+			fn.(interface {
+				ProcessElement(context.Context, []byte, int, func(int, []byte)) error
+			}).ProcessElement(context.Background(), record, shardCount, emit)
+		}
+	}
+	return shards
+}
+
+// singletons returns a bundle for each record.
+func singletons(records [][]byte) [][][]byte {
+	bundles := make([][][]byte, len(records))
+	for i, r := range records {
+		bundles[i] = [][]byte{r}
+	}
+	return bundles
+}
+
+// checkUniform checks that shards are spread over shardCount shards, each of
+// which gets within a third of its share.
+func checkUniform(t *testing.T, name string, shards []int, shardCount int) {
+	t.Helper()
+	counts := make([]int, shardCount)
+	for _, shard := range shards {
+		if shard < 0 || shard >= shardCount {
+			t.Fatalf("%s assigned a record to shard %d of %d", name, shard, shardCount)
+		}
+		counts[shard]++
+	}
+	share := len(shards) / shardCount
+	for shard, n := range counts {
+		if n < share*2/3 || n > share*4/3 {
+			t.Errorf("%s assigned %d of %d records to shard %d of %d: %v", name, n, len(shards), shard, shardCount, counts)
+			return
+		}
+	}
+}
+
+func TestShardByContentHash(t *testing.T) {
+	records := testRecords(2000)
+	for _, shardCount := range []int{2, 3, 4, 8} {
+		shards := assignShards(ShardByContentHash(), shardCount, records)
+		checkUniform(t, fmt.Sprintf("ShardByContentHash with %d shards", shardCount), shards, shardCount)
+		if again := assignShards(ShardByContentHash(), shardCount, singletons(records)...); !reflect.DeepEqual(again, shards) {
+			t.Errorf("ShardByContentHash with %d shards isn't deterministic", shardCount)
+		}
+	}
+}
+
+func TestShardRandomly(t *testing.T) {
+	records := testRecords(2000)
+	shards := assignShards(ShardRandomly(1), 4, records)
+	checkUniform(t, "ShardRandomly", shards, 4)
+	if again := assignShards(ShardRandomly(1), 4, records); !reflect.DeepEqual(again, shards) {
+		t.Error("ShardRandomly isn't reproducible for the same bundles")
+	}
+	if other := assignShards(ShardRandomly(2), 4, records); reflect.DeepEqual(other, shards) {
+		t.Error("ShardRandomly assigned the same shards with a different seed")
+	}
+
+	// Bundles of a single record must not all go to the same shard, even if
+	// each is processed by a different worker.
+	var perWorker []int
+	for _, bundle := range singletons(records) {
+		perWorker = append(perWorker, assignShards(ShardRandomly(1), 4, bundle)...)
+	}
+	checkUniform(t, "ShardRandomly with bundles of one record", perWorker, 4)
+}
+
+func TestShardRoundRobin(t *testing.T) {
+	records := testRecords(2000)
+	shards := assignShards(ShardRoundRobin(), 8, records)
+	checkUniform(t, "ShardRoundRobin", shards, 8)
+	for i := 1; i < len(shards); i++ {
+		if shards[i] != (shards[i-1]+1)%8 {
+			t.Fatalf("ShardRoundRobin assigned record %d to shard %d after shard %d", i, shards[i], shards[i-1])
+		}
+	}
+
+	// Bundles of a single record start at a random shard, which differs
+	// between DoFn instances.
+	bundles := singletons(records[:40])
+	first := assignShards(ShardRoundRobin(), 8, bundles...)
+	if second := assignShards(ShardRoundRobin(), 8, bundles...); reflect.DeepEqual(first, second) {
+		t.Errorf("two instances of ShardRoundRobin started bundles at the same shards: %v", first)
+	}
+	checkUniform(t, "ShardRoundRobin with bundles of one record", assignShards(ShardRoundRobin(), 4, singletons(records)...), 4)
+}
+
+func keyPrefix(record []byte) []byte {
+	return record[:len("record 1")]
+}
+
+// readShard returns the records of a shard file.
+func readShard(t *testing.T, filename string) [][]byte {
+	t.Helper()
+	ctx := context.Background()
+	fs, err := filesystem.New(ctx, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	fd, err := fs.OpenRead(ctx, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	rr, err := tfrecord.NewReaderFrom(fd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records [][]byte
+	for {
+		record, err := rr.ReadRecord()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("error reading %s: %v", filename, err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestShardByKey(t *testing.T) {
+	records := testRecords(500)
+	prefix := "memfs://sharding/by-key"
+	writeRecords(t, prefix, 4, records, WithSharding(ShardByKey(keyPrefix)))
+	checkRead(t, prefix+"-.*", records)
+
+	shardOfKey := map[string]string{}
+	for _, filename := range listFiles(t, prefix+"-.*") {
+		for _, record := range readShard(t, filename) {
+			key := string(keyPrefix(record))
+			if other, ok := shardOfKey[key]; ok && other != filename {
+				t.Errorf("records with key %q were written to %s and %s", key, other, filename)
+			}
+			shardOfKey[key] = filename
+		}
+	}
+	if len(shardOfKey) != 10 {
+		t.Errorf("read %d keys, want 10", len(shardOfKey))
+	}
+}
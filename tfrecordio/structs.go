@@ -0,0 +1,93 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+	"github.com/gonzojive/beam-go-bazel-example/tfrecordio/tfexample"
+)
+
+// StructsInit registers the DoFns that WriteStructs and ReadStructs use for
+// structs of type T. It must be called from an init function of the pipeline
+// binary for every struct type that is written or read.
+func StructsInit[T any]() {
+	runtime.RegisterType(reflect.TypeOf((*structToExampleFn[T])(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*structToExampleFn[T])(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*exampleToStructFn[T])(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*exampleToStructFn[T])(nil)).Elem())
+}
+
+// WriteStructs is like WriteSharded, but writes each struct of col as a
+// serialized tf.train.Example. Fields are mapped to features by their
+// "tfexample" tags as described by tfexample.FromStruct.
+func WriteStructs[T any](s beam.Scope, filenamePrefix string, shardCount int, col beamgen.Collection[T], opts ...WriteOption) beamgen.Collection[ShardInfo] {
+	s = s.Scope("tfrecord.WriteStructs")
+
+	records := beamgen.ParDo1[T, []byte](s, &structToExampleFn[T]{}, col)
+	return WriteSharded(s, filenamePrefix, shardCount, records, opts...)
+}
+
+// ReadStructs is like Read, but parses every record as a tf.train.Example and
+// converts it to a struct of type T as described by tfexample.ToStruct.
+// Records that can't be converted are logged, counted in the
+// "example_parse_failures" counter of the "tfrecordio" namespace, and dropped.
+// Use ReadStructsWithDeadLetter to keep them.
+func ReadStructs[T any](s beam.Scope, glob string, opts ...ReadOption) beamgen.Collection[T] {
+	structs, _ := ReadStructsWithDeadLetter[T](s, glob, opts...)
+	return structs
+}
+
+// ReadStructsWithDeadLetter is like ReadStructs, but also returns the records
+// that couldn't be converted.
+func ReadStructsWithDeadLetter[T any](s beam.Scope, glob string, opts ...ReadOption) (beamgen.Collection[T], beamgen.Collection[[]byte]) {
+	s = s.Scope("tfrecord.ReadStructs")
+
+	records := Read(s, glob, opts...)
+	return beamgen.ParDo2[[]byte, T, []byte](s, &exampleToStructFn[T]{}, records)
+}
+
+type structToExampleFn[T any] struct{}
+
+func (f *structToExampleFn[T]) ProcessElement(ctx context.Context, v T, emit func([]byte)) error {
+	e, err := tfexample.FromStruct(v)
+	if err != nil {
+		return fmt.Errorf("error converting %T to tf.train.Example: %w", v, err)
+	}
+	record, err := e.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshaling tf.train.Example: %w", err)
+	}
+	emit(record)
+	return nil
+}
+
+type exampleToStructFn[T any] struct {
+	parseFailures beam.Counter
+}
+
+func (f *exampleToStructFn[T]) Setup() {
+	f.parseFailures = beam.NewCounter("tfrecordio", "example_parse_failures")
+}
+
+func (f *exampleToStructFn[T]) ProcessElement(ctx context.Context, record []byte, emit func(T), deadLetter func([]byte)) error {
+	var v T
+	e, err := tfexample.ParseExample(record)
+	if err == nil {
+		err = e.ToStruct(&v)
+	}
+	if err != nil {
+		log.Warnf(ctx, "Failed to convert %d byte record to %T: %v", len(record), v, err)
+		f.parseFailures.Inc(ctx, 1)
+		deadLetter(record)
+		return nil
+	}
+	emit(v)
+	return nil
+}
@@ -0,0 +1,309 @@
+// Package tfexample encodes and decodes TensorFlow's tf.train.Example and
+// tf.train.SequenceExample protocol buffers without depending on TensorFlow.
+//
+// The encoded messages are wire compatible with the definitions in
+// tensorflow/core/example/example.proto and feature.proto, so TensorFlow
+// parses them exactly as if they were produced with the TensorFlow protos.
+package tfexample
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is the type of the values of a Feature.
+type Kind int
+
+const (
+	// KindNone is the kind of a Feature that has no value list.
+	KindNone Kind = iota
+	// KindBytes is the kind of a Feature with a bytes_list.
+	KindBytes
+	// KindFloat is the kind of a Feature with a float_list.
+	KindFloat
+	// KindInt64 is the kind of a Feature with an int64_list.
+	KindInt64
+)
+
+// String returns the name of the value list of the kind in feature.proto.
+func (k Kind) String() string {
+	switch k {
+	case KindNone:
+		return "none"
+	case KindBytes:
+		return "bytes_list"
+	case KindFloat:
+		return "float_list"
+	case KindInt64:
+		return "int64_list"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// ErrMissingFeature is returned, wrapped, by getters when there is no feature
+// with the requested name.
+var ErrMissingFeature = errors.New("missing feature")
+
+// KindError is returned by getters when a feature has a different kind than
+// the one requested.
+type KindError struct {
+	Name      string
+	Want, Got Kind
+}
+
+func (e *KindError) Error() string {
+	return fmt.Sprintf("feature %q is a %v, not a %v", e.Name, e.Got, e.Want)
+}
+
+// Feature is a list of bytes, float or int64 values, like tf.train.Feature.
+// The zero Feature has KindNone.
+type Feature struct {
+	kind   Kind
+	bytes  [][]byte
+	floats []float32
+	int64s []int64
+}
+
+// BytesFeature returns a feature with a bytes_list of values.
+func BytesFeature(values ...[]byte) Feature {
+	return Feature{kind: KindBytes, bytes: values}
+}
+
+// StringFeature returns a feature with a bytes_list of values.
+func StringFeature(values ...string) Feature {
+	bs := make([][]byte, len(values))
+	for i, v := range values {
+		bs[i] = []byte(v)
+	}
+	return BytesFeature(bs...)
+}
+
+// FloatFeature returns a feature with a float_list of values.
+func FloatFeature(values ...float32) Feature {
+	return Feature{kind: KindFloat, floats: values}
+}
+
+// Int64Feature returns a feature with an int64_list of values.
+func Int64Feature(values ...int64) Feature {
+	return Feature{kind: KindInt64, int64s: values}
+}
+
+// Kind returns the kind of the feature's values.
+func (f Feature) Kind() Kind {
+	return f.kind
+}
+
+// Len returns the number of values in the feature.
+func (f Feature) Len() int {
+	switch f.kind {
+	case KindBytes:
+		return len(f.bytes)
+	case KindFloat:
+		return len(f.floats)
+	case KindInt64:
+		return len(f.int64s)
+	default:
+		return 0
+	}
+}
+
+// Bytes returns the values of a bytes_list feature.
+func (f Feature) Bytes() ([][]byte, error) {
+	if f.kind != KindBytes {
+		return nil, &KindError{Want: KindBytes, Got: f.kind}
+	}
+	return f.bytes, nil
+}
+
+// Strings returns the values of a bytes_list feature as strings.
+func (f Feature) Strings() ([]string, error) {
+	bs, err := f.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(bs))
+	for i, b := range bs {
+		values[i] = string(b)
+	}
+	return values, nil
+}
+
+// Floats returns the values of a float_list feature.
+func (f Feature) Floats() ([]float32, error) {
+	if f.kind != KindFloat {
+		return nil, &KindError{Want: KindFloat, Got: f.kind}
+	}
+	return f.floats, nil
+}
+
+// Int64s returns the values of an int64_list feature.
+func (f Feature) Int64s() ([]int64, error) {
+	if f.kind != KindInt64 {
+		return nil, &KindError{Want: KindInt64, Got: f.kind}
+	}
+	return f.int64s, nil
+}
+
+// Features maps feature names to features, like tf.train.Features.
+type Features map[string]Feature
+
+// Set sets the named feature.
+func (fs Features) Set(name string, f Feature) {
+	fs[name] = f
+}
+
+// SetBytes sets the named feature to a bytes_list of values.
+func (fs Features) SetBytes(name string, values ...[]byte) {
+	fs[name] = BytesFeature(values...)
+}
+
+// SetStrings sets the named feature to a bytes_list of values.
+func (fs Features) SetStrings(name string, values ...string) {
+	fs[name] = StringFeature(values...)
+}
+
+// SetFloats sets the named feature to a float_list of values.
+func (fs Features) SetFloats(name string, values ...float32) {
+	fs[name] = FloatFeature(values...)
+}
+
+// SetInt64s sets the named feature to an int64_list of values.
+func (fs Features) SetInt64s(name string, values ...int64) {
+	fs[name] = Int64Feature(values...)
+}
+
+// Get returns the named feature, or an error wrapping ErrMissingFeature.
+func (fs Features) Get(name string) (Feature, error) {
+	f, ok := fs[name]
+	if !ok {
+		return Feature{}, fmt.Errorf("feature %q: %w", name, ErrMissingFeature)
+	}
+	return f, nil
+}
+
+// Bytes returns the values of the named bytes_list feature.
+func (fs Features) Bytes(name string) ([][]byte, error) {
+	f, err := fs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := f.Bytes()
+	return values, withName(err, name)
+}
+
+// Strings returns the values of the named bytes_list feature as strings.
+func (fs Features) Strings(name string) ([]string, error) {
+	f, err := fs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := f.Strings()
+	return values, withName(err, name)
+}
+
+// Floats returns the values of the named float_list feature.
+func (fs Features) Floats(name string) ([]float32, error) {
+	f, err := fs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := f.Floats()
+	return values, withName(err, name)
+}
+
+// Int64s returns the values of the named int64_list feature.
+func (fs Features) Int64s(name string) ([]int64, error) {
+	f, err := fs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := f.Int64s()
+	return values, withName(err, name)
+}
+
+// withName sets the feature name of a KindError returned by a Feature method.
+func withName(err error, name string) error {
+	var kindErr *KindError
+	if errors.As(err, &kindErr) {
+		kindErr.Name = name
+	}
+	return err
+}
+
+// Example is a set of named features, like tf.train.Example.
+type Example struct {
+	Features
+}
+
+// NewExample returns an Example with no features.
+func NewExample() *Example {
+	return &Example{Features: Features{}}
+}
+
+// FeatureLists maps names to lists of features, like tf.train.FeatureLists.
+type FeatureLists map[string][]Feature
+
+// Append adds features to the end of the named feature list.
+func (fl FeatureLists) Append(name string, features ...Feature) {
+	fl[name] = append(fl[name], features...)
+}
+
+// Get returns the named feature list, or an error wrapping
+// ErrMissingFeature.
+func (fl FeatureLists) Get(name string) ([]Feature, error) {
+	features, ok := fl[name]
+	if !ok {
+		return nil, fmt.Errorf("feature list %q: %w", name, ErrMissingFeature)
+	}
+	return features, nil
+}
+
+// Bytes returns the values of every feature in the named list, which must all
+// be bytes_list features.
+func (fl FeatureLists) Bytes(name string) ([][][]byte, error) {
+	return listValues(fl, name, Feature.Bytes)
+}
+
+// Floats returns the values of every feature in the named list, which must
+// all be float_list features.
+func (fl FeatureLists) Floats(name string) ([][]float32, error) {
+	return listValues(fl, name, Feature.Floats)
+}
+
+// Int64s returns the values of every feature in the named list, which must
+// all be int64_list features.
+func (fl FeatureLists) Int64s(name string) ([][]int64, error) {
+	return listValues(fl, name, Feature.Int64s)
+}
+
+func listValues[T any](fl FeatureLists, name string, get func(Feature) (T, error)) ([]T, error) {
+	features, err := fl.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(features))
+	for i, f := range features {
+		v, err := get(f)
+		if err != nil {
+			return nil, fmt.Errorf("feature %d of list %q: %w", i, name, withName(err, name))
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// SequenceExample is a set of context features and a set of feature lists,
+// like tf.train.SequenceExample.
+type SequenceExample struct {
+	Context      Features
+	FeatureLists FeatureLists
+}
+
+// NewSequenceExample returns a SequenceExample with no features.
+func NewSequenceExample() *SequenceExample {
+	return &SequenceExample{
+		Context:      Features{},
+		FeatureLists: FeatureLists{},
+	}
+}
@@ -0,0 +1,425 @@
+package tfexample
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FromStruct returns an Example with a feature for every field of the struct
+// that v points to, or of v itself if it is a struct.
+//
+// Each exported field is mapped to the feature named by its "tfexample" tag,
+// or by the field name if it has no tag. A tag of "-" skips the field. A tag
+// of "name,omitempty" omits the feature if the field has its zero value, and
+// lets ToStruct leave the field unchanged if the feature is missing.
+//
+// Fields are converted to features as follows:
+//
+//   - string and []byte fields, including named types based on []byte, become
+//     bytes_list features with one value.
+//   - bool and integer fields become int64_list features with one value, with
+//     true encoded as 1.
+//   - float32 and float64 fields become float_list features with one value.
+//   - Slices of the types above, including [][]byte, become lists with one
+//     value per element.
+//   - Pointers to the types above are omitted if nil.
+//   - Struct fields, and non-nil pointers to structs, are flattened into the
+//     example with their feature names prefixed by the field's name and a
+//     slash, such as "image/encoded". Embedded structs without a tag are
+//     flattened without a prefix.
+func FromStruct(v any) (*Example, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	e := NewExample()
+	if err := encodeStruct(rv, "", e.Features); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ToStruct sets the fields of the struct that v points to from the features of
+// the example, using the mapping described by FromStruct. A feature that is
+// missing is an error wrapping ErrMissingFeature, unless its field is a
+// pointer or is tagged with omitempty. Features that don't map to a field are
+// ignored.
+func (e *Example) ToStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ToStruct requires a non-nil pointer to a struct, got %T", v)
+	}
+	return decodeStruct(e.Features, rv.Elem(), "")
+}
+
+func structValue(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("FromStruct requires a struct or a pointer to a struct, got %T", v)
+	}
+	return rv, nil
+}
+
+// structField is a field of a struct that is mapped to features.
+type structField struct {
+	field reflect.StructField
+	// name is the feature name, or the prefix of the feature names of a
+	// struct field, without the prefix of the enclosing struct.
+	name      string
+	omitEmpty bool
+	// flatten is true for embedded structs without a tag, whose features
+	// have no prefix of their own.
+	flatten bool
+}
+
+// structFields returns the fields of t that are mapped to features.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("tfexample")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		isStruct := f.Type.Kind() == reflect.Struct ||
+			f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct
+		if f.Anonymous && !hasTag && isStruct {
+			fields = append(fields, structField{field: f, flatten: true})
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{
+			field:     f,
+			name:      name,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fields
+}
+
+func encodeStruct(v reflect.Value, prefix string, fs Features) error {
+	for _, f := range structFields(v.Type()) {
+		fv := v.FieldByIndex(f.field.Index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		name := prefix + f.name
+
+		switch {
+		case f.flatten:
+			if err := encodeStruct(fv, prefix, fs); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Struct:
+			if err := encodeStruct(fv, name+"/", fs); err != nil {
+				return err
+			}
+		case f.omitEmpty && fv.IsZero():
+		default:
+			feature, err := encodeValue(fv)
+			if err != nil {
+				return fmt.Errorf("field %s of %v: %w", f.field.Name, v.Type(), err)
+			}
+			fs[name] = feature
+		}
+	}
+	return nil
+}
+
+// isBytes reports whether t is a slice of bytes, such as []byte or a named
+// type based on it, which is encoded as a single bytes value.
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// encodeValue returns the feature for a scalar or slice value.
+func encodeValue(v reflect.Value) (Feature, error) {
+	if isBytes(v.Type()) {
+		return BytesFeature(v.Bytes()), nil
+	}
+	if v.Kind() != reflect.Slice {
+		return encodeList(v.Type(), 1, func(int) reflect.Value { return v })
+	}
+	return encodeList(v.Type().Elem(), v.Len(), v.Index)
+}
+
+// encodeList returns the feature for n values of type t.
+func encodeList(t reflect.Type, n int, value func(i int) reflect.Value) (Feature, error) {
+	switch {
+	case isBytes(t):
+		values := make([][]byte, n)
+		for i := range values {
+			values[i] = value(i).Bytes()
+		}
+		return BytesFeature(values...), nil
+	case t.Kind() == reflect.String:
+		values := make([][]byte, n)
+		for i := range values {
+			values[i] = []byte(value(i).String())
+		}
+		return BytesFeature(values...), nil
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		values := make([]float32, n)
+		for i := range values {
+			values[i] = float32(value(i).Float())
+		}
+		return FloatFeature(values...), nil
+	case isIntKind(t.Kind()):
+		values := make([]int64, n)
+		for i := range values {
+			x, err := toInt64(value(i))
+			if err != nil {
+				return Feature{}, err
+			}
+			values[i] = x
+		}
+		return Int64Feature(values...), nil
+	default:
+		return Feature{}, fmt.Errorf("unsupported type %v", t)
+	}
+}
+
+// isIntKind reports whether values of kind k are encoded in int64_lists.
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func toInt64(v reflect.Value) (int64, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	default:
+		x := v.Uint()
+		if int64(x) < 0 {
+			return 0, fmt.Errorf("value %d overflows int64", x)
+		}
+		return int64(x), nil
+	}
+}
+
+func decodeStruct(fs Features, v reflect.Value, prefix string) error {
+	for _, f := range structFields(v.Type()) {
+		fv := v.FieldByIndex(f.field.Index)
+		name := prefix + f.name
+		isPointer := fv.Kind() == reflect.Pointer
+
+		var err error
+		switch {
+		case f.flatten:
+			err = decodeNested(fs, fv, prefix, true)
+		case fv.Kind() == reflect.Struct || isPointer && fv.Type().Elem().Kind() == reflect.Struct:
+			err = decodeNested(fs, fv, name+"/", false)
+		default:
+			feature, ok := fs[name]
+			if !ok {
+				if f.omitEmpty || isPointer {
+					continue
+				}
+				return fmt.Errorf("feature %q: %w", name, ErrMissingFeature)
+			}
+			if isPointer {
+				fv.Set(reflect.New(fv.Type().Elem()))
+				fv = fv.Elem()
+			}
+			err = decodeValue(feature, fv)
+			var kindErr *KindError
+			if errors.As(err, &kindErr) {
+				kindErr.Name = name
+			} else if err != nil {
+				err = fmt.Errorf("feature %q: %w", name, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeNested decodes a struct or pointer to struct field. A nil pointer is
+// only allocated if the example has a feature with its prefix, unless the
+// field is flattened and therefore has no prefix of its own.
+func decodeNested(fs Features, v reflect.Value, prefix string, flatten bool) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if !flatten && !hasPrefix(fs, prefix) {
+				return nil
+			}
+			if !v.CanSet() {
+				// Like encoding/json, reflect can't allocate an embedded
+				// pointer to an unexported struct type, which is only an
+				// error if the example has features for its fields.
+				if !hasFields(fs, v.Type().Elem(), prefix) {
+					return nil
+				}
+				return fmt.Errorf("cannot set embedded pointer to unexported struct %v", v.Type().Elem())
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return decodeStruct(fs, v, prefix)
+}
+
+// hasFields reports whether fs has a feature for any field of the struct type
+// t, whose feature names start with prefix.
+func hasFields(fs Features, t reflect.Type, prefix string) bool {
+	for _, f := range structFields(t) {
+		ft := f.field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		var ok bool
+		switch {
+		case f.flatten:
+			ok = hasFields(fs, ft, prefix)
+		case ft.Kind() == reflect.Struct:
+			ok = hasPrefix(fs, prefix+f.name+"/")
+		default:
+			_, ok = fs[prefix+f.name]
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(fs Features, prefix string) bool {
+	for name := range fs {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeValue sets a scalar or slice value from a feature.
+func decodeValue(f Feature, v reflect.Value) error {
+	if isBytes(v.Type()) {
+		values, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		if len(values) != 1 {
+			return fmt.Errorf("got %d values, want 1", len(values))
+		}
+		v.SetBytes(values[0])
+		return nil
+	}
+	if v.Kind() != reflect.Slice {
+		if f.Len() != 1 {
+			if err := checkKind(f, v.Type()); err != nil {
+				return err
+			}
+			return fmt.Errorf("got %d values, want 1", f.Len())
+		}
+		return decodeList(f, v.Type(), func(int) reflect.Value { return v })
+	}
+
+	slice := reflect.MakeSlice(v.Type(), f.Len(), f.Len())
+	if err := decodeList(f, v.Type().Elem(), slice.Index); err != nil {
+		return err
+	}
+	v.Set(slice)
+	return nil
+}
+
+// checkKind returns a KindError if values of type t aren't stored in features
+// of the kind of f.
+func checkKind(f Feature, t reflect.Type) error {
+	_, err := decodeListKind(f, t)
+	return err
+}
+
+func decodeListKind(f Feature, t reflect.Type) (Kind, error) {
+	var want Kind
+	switch {
+	case isBytes(t) || t.Kind() == reflect.String:
+		want = KindBytes
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		want = KindFloat
+	case isIntKind(t.Kind()):
+		want = KindInt64
+	default:
+		return KindNone, fmt.Errorf("unsupported type %v", t)
+	}
+	if f.kind != want {
+		return want, &KindError{Want: want, Got: f.kind}
+	}
+	return want, nil
+}
+
+// decodeList sets the values returned by value, which have type t, from the
+// values of f.
+func decodeList(f Feature, t reflect.Type, value func(i int) reflect.Value) error {
+	kind, err := decodeListKind(f, t)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case KindBytes:
+		for i, b := range f.bytes {
+			if t.Kind() == reflect.String {
+				value(i).SetString(string(b))
+			} else {
+				value(i).SetBytes(b)
+			}
+		}
+	case KindFloat:
+		for i, x := range f.floats {
+			value(i).SetFloat(float64(x))
+		}
+	case KindInt64:
+		for i, x := range f.int64s {
+			if err := setInt(value(i), x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setInt(v reflect.Value, x int64) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(x != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(x) {
+			return fmt.Errorf("value %d overflows %v", x, v.Type())
+		}
+		v.SetInt(x)
+	default:
+		if x < 0 || v.OverflowUint(uint64(x)) {
+			return fmt.Errorf("value %d overflows %v", x, v.Type())
+		}
+		v.SetUint(uint64(x))
+	}
+	return nil
+}
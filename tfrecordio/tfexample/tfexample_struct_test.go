@@ -0,0 +1,63 @@
+package tfexample
+
+import (
+	"reflect"
+	"testing"
+)
+
+type blob []byte
+
+type unexportedInner struct {
+	A int64
+}
+
+func TestStructNamedByteSlices(t *testing.T) {
+	type record struct {
+		Data  blob
+		Parts []blob
+	}
+	in := record{Data: blob("data"), Parts: []blob{blob("a"), blob("b")}}
+	e, err := FromStruct(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := e.Features.Bytes("Data"); err != nil || !reflect.DeepEqual(got, [][]byte{[]byte("data")}) {
+		t.Errorf("Data feature = %q, %v; want a bytes_list holding %q", got, err, "data")
+	}
+	if got, err := e.Features.Bytes("Parts"); err != nil || !reflect.DeepEqual(got, [][]byte{[]byte("a"), []byte("b")}) {
+		t.Errorf("Parts feature = %q, %v; want a bytes_list holding %q", got, err, []string{"a", "b"})
+	}
+
+	var out record
+	if err := e.ToStruct(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("ToStruct = %+v, want %+v", out, in)
+	}
+}
+
+func TestStructUnexportedEmbeddedPointer(t *testing.T) {
+	type record struct {
+		*unexportedInner
+		B int64
+	}
+	e, err := FromStruct(record{unexportedInner: &unexportedInner{A: 1}, B: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out record
+	if err := e.ToStruct(&out); err == nil {
+		t.Errorf("ToStruct set an embedded pointer to an unexported struct: %+v", out)
+	}
+
+	delete(e.Features, "A")
+	out = record{}
+	if err := e.ToStruct(&out); err != nil {
+		t.Fatalf("ToStruct without features for the embedded struct failed: %v", err)
+	}
+	if want := (record{B: 2}); !reflect.DeepEqual(out, want) {
+		t.Errorf("ToStruct = %+v, want %+v", out, want)
+	}
+}
@@ -0,0 +1,331 @@
+package tfexample
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers from tensorflow/core/example/example.proto and feature.proto.
+const (
+	exampleFeaturesField = 1
+
+	sequenceExampleContextField      = 1
+	sequenceExampleFeatureListsField = 2
+
+	featuresFeatureField         = 1
+	featureListsFeatureListField = 1
+	featureListFeatureField      = 1
+
+	mapEntryKeyField   = 1
+	mapEntryValueField = 2
+
+	featureBytesListField = 1
+	featureFloatListField = 2
+	featureInt64ListField = 3
+
+	valueListValueField = 1
+)
+
+// Marshal returns the tf.train.Example wire encoding of the example. Features
+// are encoded in order of their names, so equal examples have equal
+// encodings.
+func (e *Example) Marshal() ([]byte, error) {
+	var b []byte
+	b = protowire.AppendTag(b, exampleFeaturesField, protowire.BytesType)
+	b = protowire.AppendBytes(b, appendFeatures(nil, e.Features))
+	return b, nil
+}
+
+// ParseExample decodes a tf.train.Example from its wire encoding.
+func ParseExample(data []byte) (*Example, error) {
+	e := NewExample()
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num == exampleFeaturesField && typ == protowire.BytesType {
+			return parseFeatures(v, e.Features)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tf.train.Example: %w", err)
+	}
+	return e, nil
+}
+
+// Marshal returns the tf.train.SequenceExample wire encoding of the example.
+// Features and feature lists are encoded in order of their names, so equal
+// examples have equal encodings.
+func (e *SequenceExample) Marshal() ([]byte, error) {
+	var b []byte
+	b = protowire.AppendTag(b, sequenceExampleContextField, protowire.BytesType)
+	b = protowire.AppendBytes(b, appendFeatures(nil, e.Context))
+	b = protowire.AppendTag(b, sequenceExampleFeatureListsField, protowire.BytesType)
+	b = protowire.AppendBytes(b, appendFeatureLists(nil, e.FeatureLists))
+	return b, nil
+}
+
+// ParseSequenceExample decodes a tf.train.SequenceExample from its wire
+// encoding.
+func ParseSequenceExample(data []byte) (*SequenceExample, error) {
+	e := NewSequenceExample()
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == sequenceExampleContextField && typ == protowire.BytesType:
+			return parseFeatures(v, e.Context)
+		case num == sequenceExampleFeatureListsField && typ == protowire.BytesType:
+			return parseFeatureLists(v, e.FeatureLists)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tf.train.SequenceExample: %w", err)
+	}
+	return e, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendFeatures(b []byte, fs Features) []byte {
+	for _, name := range sortedKeys(fs) {
+		var entry []byte
+		entry = protowire.AppendTag(entry, mapEntryKeyField, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, mapEntryValueField, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, appendFeature(nil, fs[name]))
+
+		b = protowire.AppendTag(b, featuresFeatureField, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func appendFeatureLists(b []byte, fl FeatureLists) []byte {
+	for _, name := range sortedKeys(fl) {
+		var list []byte
+		for _, f := range fl[name] {
+			list = protowire.AppendTag(list, featureListFeatureField, protowire.BytesType)
+			list = protowire.AppendBytes(list, appendFeature(nil, f))
+		}
+
+		var entry []byte
+		entry = protowire.AppendTag(entry, mapEntryKeyField, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, mapEntryValueField, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, list)
+
+		b = protowire.AppendTag(b, featureListsFeatureListField, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// appendFeature appends the encoding of a tf.train.Feature. The value list is
+// written even if it is empty, so that the kind of the feature is preserved.
+func appendFeature(b []byte, f Feature) []byte {
+	var list []byte
+	switch f.kind {
+	case KindBytes:
+		for _, v := range f.bytes {
+			list = protowire.AppendTag(list, valueListValueField, protowire.BytesType)
+			list = protowire.AppendBytes(list, v)
+		}
+		b = protowire.AppendTag(b, featureBytesListField, protowire.BytesType)
+	case KindFloat:
+		if len(f.floats) > 0 {
+			var packed []byte
+			for _, v := range f.floats {
+				packed = protowire.AppendFixed32(packed, math.Float32bits(v))
+			}
+			list = protowire.AppendTag(list, valueListValueField, protowire.BytesType)
+			list = protowire.AppendBytes(list, packed)
+		}
+		b = protowire.AppendTag(b, featureFloatListField, protowire.BytesType)
+	case KindInt64:
+		if len(f.int64s) > 0 {
+			var packed []byte
+			for _, v := range f.int64s {
+				packed = protowire.AppendVarint(packed, uint64(v))
+			}
+			list = protowire.AppendTag(list, valueListValueField, protowire.BytesType)
+			list = protowire.AppendBytes(list, packed)
+		}
+		b = protowire.AppendTag(b, featureInt64ListField, protowire.BytesType)
+	default:
+		return b
+	}
+	return protowire.AppendBytes(b, list)
+}
+
+// parseMessage calls fn with every field of an encoded message. The value of
+// a field is passed to fn as its raw bytes for length-delimited fields and as
+// the encoded value otherwise.
+func parseMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(data)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n >= 0 {
+				v = data[:n]
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMapEntry decodes the key and the encoded value of a map entry.
+func parseMapEntry(data []byte) (key string, value []byte, err error) {
+	err = parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case mapEntryKeyField:
+			key = string(v)
+		case mapEntryValueField:
+			value = v
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+func parseFeatures(data []byte, fs Features) error {
+	return parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != featuresFeatureField || typ != protowire.BytesType {
+			return nil
+		}
+		name, value, err := parseMapEntry(v)
+		if err != nil {
+			return err
+		}
+		f, err := parseFeature(value)
+		if err != nil {
+			return fmt.Errorf("feature %q: %w", name, err)
+		}
+		fs[name] = f
+		return nil
+	})
+}
+
+func parseFeatureLists(data []byte, fl FeatureLists) error {
+	return parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != featureListsFeatureListField || typ != protowire.BytesType {
+			return nil
+		}
+		name, value, err := parseMapEntry(v)
+		if err != nil {
+			return err
+		}
+		features := []Feature{}
+		err = parseMessage(value, func(num protowire.Number, typ protowire.Type, v []byte) error {
+			if num != featureListFeatureField || typ != protowire.BytesType {
+				return nil
+			}
+			f, err := parseFeature(v)
+			if err != nil {
+				return err
+			}
+			features = append(features, f)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("feature list %q: %w", name, err)
+		}
+		fl[name] = features
+		return nil
+	})
+}
+
+// parseFeature decodes a tf.train.Feature. As with any protocol buffer parser,
+// a later value list replaces an earlier one of a different kind and is merged
+// with one of the same kind.
+func parseFeature(data []byte) (Feature, error) {
+	var f Feature
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		var kind Kind
+		switch num {
+		case featureBytesListField:
+			kind = KindBytes
+		case featureFloatListField:
+			kind = KindFloat
+		case featureInt64ListField:
+			kind = KindInt64
+		default:
+			return nil
+		}
+		if f.kind != kind {
+			f = Feature{kind: kind}
+		}
+		return parseValueList(v, &f)
+	})
+	return f, err
+}
+
+// parseValueList appends the values of an encoded BytesList, FloatList or
+// Int64List to f, depending on its kind. Repeated numeric values may be packed
+// or not.
+func parseValueList(data []byte, f *Feature) error {
+	return parseMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != valueListValueField {
+			return nil
+		}
+		switch {
+		case f.kind == KindBytes && typ == protowire.BytesType:
+			f.bytes = append(f.bytes, v)
+		case f.kind == KindFloat && typ == protowire.Fixed32Type:
+			bits, _ := protowire.ConsumeFixed32(v)
+			f.floats = append(f.floats, math.Float32frombits(bits))
+		case f.kind == KindFloat && typ == protowire.BytesType:
+			if len(v)%4 != 0 {
+				return errors.New("invalid packed float_list")
+			}
+			for len(v) > 0 {
+				bits, n := protowire.ConsumeFixed32(v)
+				f.floats = append(f.floats, math.Float32frombits(bits))
+				v = v[n:]
+			}
+		case f.kind == KindInt64 && typ == protowire.VarintType:
+			x, _ := protowire.ConsumeVarint(v)
+			f.int64s = append(f.int64s, int64(x))
+		case f.kind == KindInt64 && typ == protowire.BytesType:
+			for len(v) > 0 {
+				x, n := protowire.ConsumeVarint(v)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				f.int64s = append(f.int64s, int64(x))
+				v = v[n:]
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+package tfexample
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// unhex decodes hex digits separated by spaces.
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// exampleEncoding is the encoding of testExample, worked out by hand from
+// example.proto and feature.proto.
+const exampleEncoding = "0a 33" + // Example.features
+	// Map entry "a": int64_list with packed values 1 and 300.
+	" 0a 0c 0a 01 61 12 07 1a 05 0a 03 01 ac 02" +
+	// Map entry "b": bytes_list with value "xy".
+	" 0a 0b 0a 01 62 12 06 0a 04 0a 02 78 79" +
+	// Map entry "c": float_list with packed value 1.5.
+	" 0a 0d 0a 01 63 12 08 12 06 0a 04 00 00 c0 3f" +
+	// Map entry "d": empty int64_list.
+	" 0a 07 0a 01 64 12 02 1a 00"
+
+func testExample() *Example {
+	e := NewExample()
+	e.SetInt64s("a", 1, 300)
+	e.SetStrings("b", "xy")
+	e.SetFloats("c", 1.5)
+	e.SetInt64s("d")
+	return e
+}
+
+func TestExampleMarshal(t *testing.T) {
+	got, err := testExample().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex(t, exampleEncoding); !bytes.Equal(got, want) {
+		t.Errorf("Marshal() = % x, want % x", got, want)
+	}
+}
+
+func TestParseExample(t *testing.T) {
+	e, err := ParseExample(unhex(t, exampleEncoding))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testExample(); !reflect.DeepEqual(e, want) {
+		t.Errorf("ParseExample = %+v, want %+v", e, want)
+	}
+}
+
+func TestParseExampleUnpacked(t *testing.T) {
+	// Parsers must accept repeated numeric fields that aren't packed.
+	e, err := ParseExample(unhex(t, "0a 1c"+
+		// Map entry "a": int64_list with unpacked values 1 and 300.
+		" 0a 0c 0a 01 61 12 07 1a 05 08 01 08 ac 02"+
+		// Map entry "c": float_list with unpacked value 1.5.
+		" 0a 0c 0a 01 63 12 07 12 05 0d 00 00 c0 3f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := e.Int64s("a"); err != nil || !reflect.DeepEqual(got, []int64{1, 300}) {
+		t.Errorf("Int64s(%q) = %v, %v; want [1 300]", "a", got, err)
+	}
+	if got, err := e.Floats("c"); err != nil || !reflect.DeepEqual(got, []float32{1.5}) {
+		t.Errorf("Floats(%q) = %v, %v; want [1.5]", "c", got, err)
+	}
+}
+
+func TestParseExampleTruncated(t *testing.T) {
+	data := unhex(t, exampleEncoding)
+	for n := 1; n < len(data); n++ {
+		if e, err := ParseExample(data[:n]); err == nil {
+			t.Errorf("ParseExample of the first %d bytes returned %+v", n, e)
+		}
+	}
+}
+
+// sequenceExampleEncoding is the encoding of testSequenceExample, worked out
+// by hand from example.proto and feature.proto.
+const sequenceExampleEncoding = "0a 0c" + // SequenceExample.context
+	// Map entry "l": int64_list with value 2.
+	" 0a 0a 0a 01 6c 12 05 1a 03 0a 01 02" +
+	" 12 15" + // SequenceExample.feature_lists
+	// Map entry "t": a FeatureList of bytes_lists with values "a" and "b".
+	" 0a 13 0a 01 74 12 0e 0a 05 0a 03 0a 01 61 0a 05 0a 03 0a 01 62"
+
+func testSequenceExample() *SequenceExample {
+	e := NewSequenceExample()
+	e.Context.SetInt64s("l", 2)
+	e.FeatureLists.Append("t", StringFeature("a"), StringFeature("b"))
+	return e
+}
+
+func TestSequenceExampleMarshal(t *testing.T) {
+	got, err := testSequenceExample().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex(t, sequenceExampleEncoding); !bytes.Equal(got, want) {
+		t.Errorf("Marshal() = % x, want % x", got, want)
+	}
+}
+
+func TestParseSequenceExample(t *testing.T) {
+	e, err := ParseSequenceExample(unhex(t, sequenceExampleEncoding))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testSequenceExample(); !reflect.DeepEqual(e, want) {
+		t.Errorf("ParseSequenceExample = %+v, want %+v", e, want)
+	}
+}
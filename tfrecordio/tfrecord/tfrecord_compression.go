@@ -0,0 +1,196 @@
+package tfrecord
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionType denotes how the records of a TFRecord file are compressed.
+// Compression is applied to the file as a whole rather than per record.
+//
+// A ZLib-compressed TFRecord file is a single zlib stream (RFC 1950) wrapping
+// the records and a GZIP-compressed file is a gzip stream (RFC 1952); these
+// are what TensorFlow reads with compression_type="ZLIB" and "GZIP".
+//
+// Snappy files use the snappy framing format, which is what most tools write
+// to ".snappy" files. TensorFlow's own SNAPPY record option uses a different
+// block format and cannot read them. Zstd files are a standard zstd stream.
+type CompressionType int
+
+const (
+	CompressionTypeNone CompressionType = iota
+	CompressionTypeZlib
+	CompressionTypeGzip
+	CompressionTypeSnappy
+	CompressionTypeZstd
+
+	// CompressionTypeAuto detects the compression type of each file. Readers
+	// inspect the leading bytes of every file, falling back to the file
+	// extension, so a single RecordReader can read a queue of files that use
+	// different compression types. Writers choose the compression type from
+	// the extension of the destination path.
+	CompressionTypeAuto CompressionType = -1
+)
+
+// String returns the name TensorFlow uses for the compression type, or "" for
+// CompressionTypeNone.
+func (ct CompressionType) String() string {
+	switch ct {
+	case CompressionTypeNone:
+		return ""
+	case CompressionTypeZlib:
+		return "ZLIB"
+	case CompressionTypeGzip:
+		return "GZIP"
+	case CompressionTypeSnappy:
+		return "SNAPPY"
+	case CompressionTypeZstd:
+		return "ZSTD"
+	case CompressionTypeAuto:
+		return "AUTO"
+	default:
+		return fmt.Sprintf("CompressionType(%d)", int(ct))
+	}
+}
+
+// Extension returns the conventional file extension for the compression type,
+// including the leading dot, or "" if there is none.
+func (ct CompressionType) Extension() string {
+	switch ct {
+	case CompressionTypeZlib:
+		return ".zlib"
+	case CompressionTypeGzip:
+		return ".gz"
+	case CompressionTypeSnappy:
+		return ".snappy"
+	case CompressionTypeZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// CompressionTypeFromPath returns the compression type implied by the
+// extension of a file path, or CompressionTypeNone if the extension is not
+// recognized.
+func CompressionTypeFromPath(filename string) CompressionType {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".zlib", ".zz":
+		return CompressionTypeZlib
+	case ".gz", ".gzip":
+		return CompressionTypeGzip
+	case ".snappy", ".sz":
+		return CompressionTypeSnappy
+	case ".zst", ".zstd":
+		return CompressionTypeZstd
+	default:
+		return CompressionTypeNone
+	}
+}
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// DetectCompressionType returns the compression type of a file based on its
+// leading bytes. It returns CompressionTypeAuto if header is not recognized,
+// for example because it is too short.
+//
+// An uncompressed TFRecord file is recognized by the checksum of its first
+// record's length, so header should hold at least 12 bytes.
+func DetectCompressionType(header []byte) CompressionType {
+	switch {
+	case len(header) >= 12 && MaskedCRC(header, 8) == binary.LittleEndian.Uint32(header[8:12]):
+		return CompressionTypeNone
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionTypeGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionTypeZstd
+	case bytes.HasPrefix(header, snappyMagic):
+		return CompressionTypeSnappy
+	case len(header) >= 2 && isZlibHeader(header[0], header[1]):
+		return CompressionTypeZlib
+	default:
+		return CompressionTypeAuto
+	}
+}
+
+// isZlibHeader reports whether cmf and flg form a valid RFC 1950 header for a
+// deflate stream without a preset dictionary.
+func isZlibHeader(cmf, flg byte) bool {
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && flg&0x20 == 0 && (uint16(cmf)<<8|uint16(flg))%31 == 0
+}
+
+// detectCompressionType resolves CompressionTypeAuto for a file that is about
+// to be read through r, using the file's leading bytes and then its name.
+func detectCompressionType(r *bufio.Reader, filename string) CompressionType {
+	// Peek may return fewer bytes than asked for along with an error; a short
+	// header is still good enough to detect most formats.
+	header, _ := r.Peek(12)
+	if ct := DetectCompressionType(header); ct != CompressionTypeAuto {
+		return ct
+	}
+	return CompressionTypeFromPath(filename)
+}
+
+// compressor is a compressed stream that wraps an underlying writer. Flush
+// writes any pending compressed data to the underlying writer and Close
+// finishes the stream without closing the underlying writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// newCompressor returns a compressor that writes to w using the given
+// compression type, or nil if the type is CompressionTypeNone.
+func newCompressor(w io.Writer, ct CompressionType) (compressor, error) {
+	switch ct {
+	case CompressionTypeNone:
+		return nil, nil
+	case CompressionTypeZlib:
+		return zlib.NewWriter(w), nil
+	case CompressionTypeGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionTypeSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	case CompressionTypeZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported compression type %v", ct)
+	}
+}
+
+// newDecompressor returns a reader that decompresses r using the given
+// compression type. The returned io.ReadCloser does not close r.
+func newDecompressor(r io.Reader, ct CompressionType) (io.ReadCloser, error) {
+	switch ct {
+	case CompressionTypeNone:
+		return io.NopCloser(r), nil
+	case CompressionTypeZlib:
+		return zlib.NewReader(r)
+	case CompressionTypeGzip:
+		return gzip.NewReader(r)
+	case CompressionTypeSnappy:
+		return io.NopCloser(snappy.NewReader(r)), nil
+	case CompressionTypeZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression type %v", ct)
+	}
+}
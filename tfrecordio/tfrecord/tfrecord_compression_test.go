@@ -0,0 +1,139 @@
+package tfrecord
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var compressionTypes = []CompressionType{
+	CompressionTypeNone,
+	CompressionTypeZlib,
+	CompressionTypeGzip,
+	CompressionTypeSnappy,
+	CompressionTypeZstd,
+}
+
+// testRecords returns n distinct records of varying lengths.
+func testRecords(n int) [][]byte {
+	records := make([][]byte, n)
+	for i := range records {
+		records[i] = []byte(fmt.Sprintf("record %d %s", i, bytes.Repeat([]byte{'x'}, i*7%100)))
+	}
+	return records
+}
+
+// encode returns records as a TFRecord stream compressed with ct.
+func encode(t *testing.T, ct CompressionType, records [][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriterFrom(&buf, &RecordWriterOptions{CompressionType: ct})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readAll reads records from rr until io.EOF.
+func readAll(t *testing.T, rr *RecordReader) [][]byte {
+	t.Helper()
+	var records [][]byte
+	for {
+		r, err := rr.ReadRecord()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("error reading record %d: %v", len(records), err)
+		}
+		records = append(records, r)
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	records := testRecords(100)
+	for _, ct := range compressionTypes {
+		data := encode(t, ct, records)
+		for _, readAs := range []CompressionType{ct, CompressionTypeAuto} {
+			rr, err := NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{CompressionType: readAs})
+			if err != nil {
+				t.Fatalf("%q read as %q: %v", ct, readAs, err)
+			}
+			if got := readAll(t, rr); !reflect.DeepEqual(got, records) {
+				t.Errorf("%q read as %q returned %d records that don't match the %d written", ct, readAs, len(got), len(records))
+			}
+		}
+	}
+}
+
+func TestCompressionFromFileExtension(t *testing.T) {
+	records := testRecords(20)
+	var queue [][]byte
+	var filenames []string
+	for _, ct := range compressionTypes {
+		filename := filepath.Join(t.TempDir(), "data.tfrecord"+ct.Extension())
+		w, err := NewWriter(filename, &RecordWriterOptions{CompressionType: CompressionTypeAuto})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			if err := w.WriteRecord(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+		queue = append(queue, records...)
+	}
+
+	rr, err := NewReader(filenames, &RecordReaderOptions{CompressionType: CompressionTypeAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, rr); !reflect.DeepEqual(got, queue) {
+		t.Errorf("reading %q returned %d records that don't match the %d written", filenames, len(got), len(queue))
+	}
+}
+
+func TestDetectCompressionType(t *testing.T) {
+	records := testRecords(1)
+	for _, ct := range compressionTypes {
+		if got := DetectCompressionType(encode(t, ct, records)); got != ct {
+			t.Errorf("DetectCompressionType of a %q stream = %q", ct, got)
+		}
+	}
+	for _, header := range [][]byte{nil, []byte("x"), []byte("not a tfrecord file")} {
+		if got := DetectCompressionType(header); got != CompressionTypeAuto {
+			t.Errorf("DetectCompressionType(%q) = %q, want %q", header, got, CompressionTypeAuto)
+		}
+	}
+}
+
+func TestCompressionTypeFromPath(t *testing.T) {
+	for path, want := range map[string]CompressionType{
+		"train.tfrecord":        CompressionTypeNone,
+		"train.tfrecord.zlib":   CompressionTypeZlib,
+		"train.tfrecord.gz":     CompressionTypeGzip,
+		"train.tfrecord.GZIP":   CompressionTypeGzip,
+		"train.tfrecord.snappy": CompressionTypeSnappy,
+		"train.tfrecord.zst":    CompressionTypeZstd,
+		"gs://bucket/dir.gz/a":  CompressionTypeNone,
+	} {
+		if got := CompressionTypeFromPath(path); got != want {
+			t.Errorf("CompressionTypeFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package tfrecord
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// IndexEntry is the position of a record in an uncompressed TFRecord file.
+type IndexEntry struct {
+	// Offset is the offset of the record's header in the file.
+	Offset int64
+	// Length is the length of the encoded record, which is 16 bytes longer
+	// than its data.
+	Length int64
+}
+
+// String returns the entry as a line of an index file, without the newline.
+func (e IndexEntry) String() string {
+	return fmt.Sprintf("%d %d", e.Offset, e.Length)
+}
+
+// Index lists the positions of the records of an uncompressed TFRecord file,
+// in order. Index files hold one "offset length" line per record, which is the
+// format of the index files used by NVIDIA DALI.
+type Index []IndexEntry
+
+// IndexFilename returns the name of the index file of a TFRecord file.
+func IndexFilename(path string) string {
+	return path + ".idx"
+}
+
+// WriteTo writes the index in the index file format.
+func (idx Index) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	for _, e := range idx {
+		m, err := bw.WriteString(e.String() + "\n")
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadIndex reads an index in the index file format.
+func ReadIndex(r io.Reader) (Index, error) {
+	var idx Index
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid index line %d: %q", line, scanner.Text())
+		}
+		offset, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset on index line %d: %w", line, err)
+		}
+		length, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid length on index line %d: %w", line, err)
+		}
+		if offset < 0 || length < 16 {
+			return nil, fmt.Errorf("invalid index line %d: %q", line, scanner.Text())
+		}
+		idx = append(idx, IndexEntry{Offset: offset, Length: length})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// ReadIndexFile reads the index file of the TFRecord file at path.
+func ReadIndexFile(path string) (Index, error) {
+	f, err := os.Open(IndexFilename(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadIndex(f)
+}
+
+// BuildIndex reads the records of an uncompressed TFRecord stream and returns
+// their index. Every record is checked, so an error is returned if any of them
+// is corrupt.
+func BuildIndex(r io.Reader) (Index, error) {
+	rr, err := NewReaderFrom(r, &RecordReaderOptions{CompressionType: CompressionTypeNone})
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	for {
+		offset := rr.offset
+		data, length, err := rr.NextRecordReader()
+		if err == io.EOF {
+			return idx, nil
+		}
+		if err == nil {
+			_, err = io.Copy(io.Discard, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record %d at offset %d: %w", len(idx), offset, err)
+		}
+		idx = append(idx, IndexEntry{Offset: offset, Length: length + 16})
+	}
+}
+
+// BuildIndexFile builds the index of the uncompressed TFRecord file at path
+// and writes it to the file named by IndexFilename.
+func BuildIndexFile(path string) (Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx, err := BuildIndex(f)
+	if err != nil {
+		return nil, fmt.Errorf("error indexing %s: %w", path, err)
+	}
+
+	out, err := os.OpenFile(IndexFilename(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := idx.WriteTo(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return idx, out.Close()
+}
+
+// NewIndexedReader returns a record reader of the uncompressed TFRecord stream
+// r that can jump to any record with SeekToRecord, using the index of r. It
+// starts at the first record.
+func NewIndexedReader(r io.ReadSeeker, index Index, options *RecordReaderOptions) (*RecordReader, error) {
+	resolved := RecordReaderOptions{}
+	if options != nil {
+		resolved = *options
+	}
+	if resolved.CompressionType != CompressionTypeNone && resolved.CompressionType != CompressionTypeAuto {
+		return nil, fmt.Errorf("indexed readers require uncompressed records, not %v", resolved.CompressionType)
+	}
+	resolved.CompressionType = CompressionTypeNone
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rr := &RecordReader{
+		options: &resolved,
+		seeker:  r,
+		index:   index,
+	}
+	if err := rr.startStream(r, ""); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// SeekToRecord positions a reader created with NewIndexedReader so that the
+// next record it reads is record n, counting from zero. Seeking to the number
+// of records in the index positions the reader at the end of the stream. An
+// error is returned if the header of the record doesn't match the index.
+func (rr *RecordReader) SeekToRecord(n int) error {
+	if rr.closed {
+		return errReaderClosed
+	}
+	if rr.seeker == nil {
+		return errors.New("SeekToRecord requires a reader created with NewIndexedReader")
+	}
+	if n < 0 || n > len(rr.index) {
+		return fmt.Errorf("record %d is out of range; the index has %d records", n, len(rr.index))
+	}
+	var offset int64
+	if n < len(rr.index) {
+		offset = rr.index[n].Offset
+	} else if n > 0 {
+		last := rr.index[n-1]
+		offset = last.Offset + last.Length
+	}
+
+	if _, err := rr.seeker.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	rr.setStream(rr.seeker)
+	rr.decompressor = io.NopCloser(nil)
+	rr.offset = offset
+	rr.recordStream = nil
+	if n == len(rr.index) {
+		return nil
+	}
+
+	hbs, err := rr.reader.Peek(12)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return fmt.Errorf("error reading record %d at offset %d: %w", n, offset, err)
+	}
+	if MaskedCRC(hbs, 8) != binary.LittleEndian.Uint32(hbs[8:]) {
+		return fmt.Errorf("index entry %d doesn't point at a record header at offset %d", n, offset)
+	}
+	if length := binary.LittleEndian.Uint64(hbs); length+16 != uint64(rr.index[n].Length) {
+		return fmt.Errorf("record %d at offset %d has length %d, but its index entry has length %d", n, offset, length+16, rr.index[n].Length)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package tfrecord
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriterIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.tfrecord")
+	w, err := NewWriter(path, &RecordWriterOptions{WriteIndex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"record", "record1", "record22"} {
+		if err := w.WriteRecord([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(IndexFilename(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0 22\n22 23\n45 24\n"; string(got) != want {
+		t.Errorf("index file holds %q, want %q", got, want)
+	}
+
+	idx, err := BuildIndexFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Index{{0, 22}, {22, 23}, {45, 24}}); !reflect.DeepEqual(idx, want) {
+		t.Errorf("BuildIndexFile = %v, want %v", idx, want)
+	}
+	if rebuilt, err := os.ReadFile(IndexFilename(path)); err != nil || !bytes.Equal(rebuilt, got) {
+		t.Errorf("BuildIndexFile wrote %q, %v; want %q", rebuilt, err, got)
+	}
+}
+
+func TestWriterIndexRequiresUncompressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.tfrecord.gz")
+	if _, err := NewWriter(path, &RecordWriterOptions{CompressionType: CompressionTypeAuto, WriteIndex: true}); err == nil {
+		t.Error("NewWriter wrote an index of a compressed file")
+	}
+}
+
+func TestReadIndex(t *testing.T) {
+	idx, err := ReadIndex(strings.NewReader("0 22\n\n22 23\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Index{{0, 22}, {22, 23}}); !reflect.DeepEqual(idx, want) {
+		t.Errorf("ReadIndex = %v, want %v", idx, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err := idx.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "0 22\n22 23\n"; got != want {
+		t.Errorf("WriteTo wrote %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"0\n", "0 22 1\n", "x 22\n", "0 y\n", "-1 22\n", "0 15\n"} {
+		if _, err := ReadIndex(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadIndex(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSeekToRecord(t *testing.T) {
+	records := testRecords(20)
+	data := encode(t, CompressionTypeNone, records)
+	idx, err := BuildIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx) != len(records) {
+		t.Fatalf("BuildIndex returned %d entries, want %d", len(idx), len(records))
+	}
+
+	rr, err := NewIndexedReader(bytes.NewReader(data), idx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{7, 0, 19, 3, 3} {
+		if err := rr.SeekToRecord(n); err != nil {
+			t.Fatalf("SeekToRecord(%d): %v", n, err)
+		}
+		got, err := rr.ReadRecord()
+		if err != nil {
+			t.Fatalf("ReadRecord after SeekToRecord(%d): %v", n, err)
+		}
+		if !bytes.Equal(got, records[n]) {
+			t.Errorf("ReadRecord after SeekToRecord(%d) = %q, want %q", n, got, records[n])
+		}
+	}
+
+	if err := rr.SeekToRecord(len(idx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.ReadRecord(); err != io.EOF {
+		t.Errorf("ReadRecord at the end of the index returned %v, want io.EOF", err)
+	}
+	if err := rr.SeekToRecord(len(idx) + 1); err == nil {
+		t.Error("SeekToRecord past the end of the index succeeded")
+	}
+}
+
+func TestSeekToRecordBadIndex(t *testing.T) {
+	records := testRecords(3)
+	data := encode(t, CompressionTypeNone, records)
+	idx, err := BuildIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []Index{
+		{idx[0], {idx[1].Offset + 1, idx[1].Length}, idx[2]},
+		{idx[0], {idx[1].Offset, idx[1].Length + 1}, idx[2]},
+	} {
+		rr, err := NewIndexedReader(bytes.NewReader(data), bad, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rr.SeekToRecord(1); err == nil {
+			t.Errorf("SeekToRecord with index entry %v succeeded", bad[1])
+		}
+	}
+
+	if _, err := NewIndexedReader(bytes.NewReader(data), idx, &RecordReaderOptions{CompressionType: CompressionTypeGzip}); err == nil {
+		t.Error("NewIndexedReader accepted a compressed stream")
+	}
+	rr, err := NewReaderFrom(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rr.SeekToRecord(0); err == nil {
+		t.Error("SeekToRecord succeeded on a reader without an index")
+	}
+}
@@ -0,0 +1,119 @@
+package tfrecord
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReaderPosition is the position of a RecordReader in its queue of files,
+// which can be saved and later passed to NewReaderAt to resume reading where
+// the reader left off.
+type ReaderPosition struct {
+	// FileIndex is the index in the queue of the file that holds the next
+	// record, or the length of the queue once every file has been read.
+	FileIndex int `json:"fileIndex"`
+	// Offset is the offset of the next record in the file. For compressed
+	// files, it is the offset in the decompressed stream.
+	Offset int64 `json:"offset"`
+	// RecordsProduced is the number of records that the reader had produced.
+	RecordsProduced int `json:"recordsProduced"`
+}
+
+// Position returns the position of the next record that the reader will read.
+// If a record returned by NextRecordReader hasn't been read to the end, the
+// next record is the one after it, and the record is counted as produced
+// although its checksum hasn't been checked. The file index of a reader
+// created with NewReaderFrom is 0 until its stream ends, and then 1.
+func (rr *RecordReader) Position() ReaderPosition {
+	pos := ReaderPosition{
+		FileIndex:       rr.fileIndex,
+		RecordsProduced: rr.recordsProduced,
+	}
+	if rr.reader != nil {
+		pos.Offset = rr.offset
+		if r := rr.recordStream; r != nil && r.err == nil {
+			pos.Offset += r.remaining + 4
+			pos.RecordsProduced++
+		}
+	}
+	return pos
+}
+
+// NewReaderAt is like NewReader, but resumes reading queue at a position
+// returned by Position of a reader of the same queue. It returns an error
+// wrapping ErrNoRecordBoundary if the header of a record doesn't start at the
+// position, such as when the file has changed since the position was saved.
+//
+// Uncompressed files that the opener returns as an io.Seeker are read from the
+// position directly. Other files are read from their start, and the bytes
+// before the position are discarded.
+func NewReaderAt(queue []string, pos ReaderPosition, options *RecordReaderOptions) (*RecordReader, error) {
+	if pos.FileIndex < 0 || pos.FileIndex > len(queue) || pos.Offset < 0 ||
+		pos.FileIndex == len(queue) && pos.Offset != 0 {
+		return nil, fmt.Errorf("invalid position %+v of a queue of %d files", pos, len(queue))
+	}
+	rr, err := NewReader(queue[pos.FileIndex:], options)
+	if err != nil {
+		return nil, err
+	}
+	rr.fileIndex = pos.FileIndex
+	rr.recordsProduced = pos.RecordsProduced
+	if pos.Offset == 0 {
+		// The start of a file is always a record boundary.
+		return rr, nil
+	}
+
+	var filename string
+	filename, rr.queue = rr.queue[0], rr.queue[1:]
+	f, err := rr.open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := rr.resumeStream(f, filename, pos.Offset); err != nil {
+		rr.closeStream()
+		return nil, err
+	}
+	return rr, nil
+}
+
+// resumeStream starts reading the file f at offset, and checks that a record
+// header starts there. The file is closed with the stream, even if an error is
+// returned.
+func (rr *RecordReader) resumeStream(f io.ReadCloser, filename string, offset int64) error {
+	rr.file, rr.filename = f, filename
+	if err := rr.startStream(f, filename); err != nil {
+		return fmt.Errorf("error opening %s: %w", filename, err)
+	}
+	if rr.reader == nil {
+		return fmt.Errorf("offset %d is past the end of empty file %s", offset, filename)
+	}
+
+	if seeker, ok := f.(io.Seeker); ok && rr.uncompressed {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("error seeking to offset %d of %s: %w", offset, filename, err)
+		}
+		rr.setStream(f)
+	} else if _, err := rr.reader.Discard(int(offset)); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("offset %d is past the end of %s", offset, filename)
+		}
+		return fmt.Errorf("error skipping to offset %d of %s: %w", offset, filename, err)
+	}
+	rr.offset = offset
+
+	if rr.streamSize >= 0 && offset > rr.streamSize {
+		return fmt.Errorf("offset %d is past the end of %s", offset, filename)
+	}
+	ok, err := rr.atRecordHeader()
+	if err == io.EOF && rr.reader.Buffered() == 0 {
+		// The position is at the end of the file.
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading %s at offset %d: %w", filename, offset, err)
+	}
+	if !ok {
+		return fmt.Errorf("offset %d of %s: %w", offset, filename, ErrNoRecordBoundary)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package tfrecord
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeQueue writes records to one file per compression type in
+// compressionTypes and returns the files and the records they hold, in order.
+func writeQueue(t *testing.T, perFile int) ([]string, [][]byte) {
+	t.Helper()
+	dir := t.TempDir()
+	var queue []string
+	var all [][]byte
+	for i, ct := range compressionTypes {
+		records := testRecords(perFile)
+		filename := filepath.Join(dir, string(rune('a'+i))+".tfrecord"+ct.Extension())
+		if err := os.WriteFile(filename, encode(t, ct, records), 0600); err != nil {
+			t.Fatal(err)
+		}
+		queue = append(queue, filename)
+		all = append(all, records...)
+	}
+	return queue, all
+}
+
+func TestNewReaderAt(t *testing.T) {
+	queue, records := writeQueue(t, 5)
+	options := &RecordReaderOptions{CompressionType: CompressionTypeAuto}
+
+	rr, err := NewReader(queue, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var positions []ReaderPosition
+	for {
+		positions = append(positions, rr.Position())
+		if _, err := rr.ReadRecord(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(positions) != len(records)+1 {
+		t.Fatalf("got %d positions, want %d", len(positions), len(records)+1)
+	}
+
+	for n, pos := range positions {
+		if pos.RecordsProduced != n {
+			t.Errorf("position %+v before record %d has the wrong record count", pos, n)
+		}
+		resumed, err := NewReaderAt(queue, pos, options)
+		if err != nil {
+			t.Fatalf("NewReaderAt(%+v): %v", pos, err)
+		}
+		got := append([][]byte{}, readAll(t, resumed)...)
+		if want := records[n:]; !reflect.DeepEqual(got, want) {
+			t.Errorf("reader resumed at %+v read %d records, want the last %d", pos, len(got), len(want))
+		}
+		if resumed.NumRecordsProduced() != len(records) {
+			t.Errorf("reader resumed at %+v produced %d records in total, want %d", pos, resumed.NumRecordsProduced(), len(records))
+		}
+	}
+}
+
+func TestPositionWithUnreadRecord(t *testing.T) {
+	queue, records := writeQueue(t, 3)
+	rr, err := NewReader(queue, &RecordReaderOptions{CompressionType: CompressionTypeAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rr.NextRecordReader(); err != nil {
+		t.Fatal(err)
+	}
+	pos := rr.Position()
+	if pos.RecordsProduced != 1 {
+		t.Errorf("Position() = %+v, want a position after the first record", pos)
+	}
+
+	resumed, err := NewReaderAt(queue, pos, &RecordReaderOptions{CompressionType: CompressionTypeAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, resumed); !reflect.DeepEqual(got, records[1:]) {
+		t.Errorf("reader resumed at %+v read %d records, want %d", pos, len(got), len(records)-1)
+	}
+}
+
+func TestNewReaderAtInvalidPosition(t *testing.T) {
+	queue, _ := writeQueue(t, 3)
+	options := &RecordReaderOptions{CompressionType: CompressionTypeAuto}
+
+	for _, pos := range []ReaderPosition{
+		{FileIndex: -1},
+		{FileIndex: len(queue) + 1},
+		{FileIndex: len(queue), Offset: 1},
+		{FileIndex: 0, Offset: -1},
+		{FileIndex: 0, Offset: 1 << 20},
+	} {
+		if _, err := NewReaderAt(queue, pos, options); err == nil {
+			t.Errorf("NewReaderAt(%+v) succeeded", pos)
+		}
+	}
+
+	for i := range queue {
+		pos := ReaderPosition{FileIndex: i, Offset: 5}
+		if _, err := NewReaderAt(queue, pos, options); !errors.Is(err, ErrNoRecordBoundary) {
+			t.Errorf("NewReaderAt(%+v) of %s returned %v, want %v", pos, queue[i], err, ErrNoRecordBoundary)
+		}
+	}
+}
@@ -4,13 +4,37 @@ import (
 	"bufio"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"math"
 	"os"
 )
 
 // RecordReaderOptions specify reader options for the tf record reader.
 type RecordReaderOptions struct {
 	CompressionType CompressionType
+
+	// Opener opens the files in the queue of a reader created with NewReader.
+	// It defaults to os.Open, but may be set to read files from elsewhere,
+	// such as a Beam filesystem.Interface.
+	Opener func(filename string) (io.ReadCloser, error)
+
+	// SkipCorruptRecords makes the reader skip records whose length or data
+	// checksum doesn't match, or that are cut short by the end of the stream,
+	// instead of returning an error. After a corrupt record, the reader scans
+	// forward one byte at a time until it finds the start of a valid record
+	// and continues reading from there. The number of records and bytes that
+	// were skipped is reported by NumRecordsSkipped and NumBytesSkipped.
+	SkipCorruptRecords bool
+
+	// MaxRecordSize is the largest record length that the reader accepts. A
+	// record with a longer length in its header makes ReadRecord return a
+	// *RecordTooLargeError instead of allocating memory for it. Zero means
+	// there is no limit.
+	MaxRecordSize int64
+
 	// TODO: bufferSize?
 	// TODO: zlibOptions?
 }
@@ -22,13 +46,99 @@ type RecordReader struct {
 	queue   []string // file queue of files to read in
 	options *RecordReaderOptions
 
-	reader          *bufio.Reader
+	reader       *bufio.Reader
+	decompressor io.Closer
+	// pushback holds bytes that atRecordBoundary has read ahead and put back
+	// in front of the current stream.
+	pushback        *pushbackReader
 	recordsProduced int
+
+	// file and filename are the file from the queue that the current stream
+	// reads, if any.
+	file     io.Closer
+	filename string
+	closed   bool
+	// fileIndex is the position in the original queue of the file that the
+	// current stream reads, or of the next file if there is no stream.
+	fileIndex int
+	// uncompressed is true if the current stream isn't compressed.
+	uncompressed bool
+
+	// offset is the number of bytes read from the current decompressed
+	// stream.
+	offset int64
+	// streamSize is the size of the current stream if it is known, or -1.
+	streamSize int64
+
+	recordsSkipped int
+	bytesSkipped   int64
+
+	// recordStream is the reader returned by the last call to
+	// NextRecordReader, which must be read to the end before the next record.
+	recordStream *recordDataReader
+
+	// seeker and index are set for readers created with NewIndexedReader.
+	seeker io.ReadSeeker
+	index  Index
+}
+
+// ErrCorruptRecord is returned, wrapped, by ReadRecord when the length or data
+// checksum of a record doesn't match, or the stream ends in the middle of a
+// record, unless the reader skips corrupt records.
+var ErrCorruptRecord = errors.New("corrupt record")
+
+// errTruncatedRecord is returned, wrapped, when a stream ends in the middle of
+// a record. It matches both io.ErrUnexpectedEOF and ErrCorruptRecord.
+var errTruncatedRecord error = truncatedRecordError{}
+
+type truncatedRecordError struct{}
+
+func (truncatedRecordError) Error() string {
+	return io.ErrUnexpectedEOF.Error()
+}
+
+// Is reports whether the error matches io.ErrUnexpectedEOF or
+// ErrCorruptRecord.
+func (truncatedRecordError) Is(target error) bool {
+	return target == io.ErrUnexpectedEOF || target == ErrCorruptRecord
+}
+
+// RecordTooLargeError is returned by ReadRecord when the length in the header
+// of a record exceeds RecordReaderOptions.MaxRecordSize, or the number of
+// bytes left in the file if that is known.
+type RecordTooLargeError struct {
+	// Length is the length of the record's data according to its header.
+	Length uint64
+	// Limit is the largest length that was allowed.
+	Limit int64
+	// PastEOF is true if Limit is the number of bytes left in the file rather
+	// than the maximum record size. Such a record is either truncated or has
+	// a corrupt length, so the error matches ErrCorruptRecord and
+	// io.ErrUnexpectedEOF.
+	PastEOF bool
+}
+
+func (e *RecordTooLargeError) Error() string {
+	if e.PastEOF {
+		return fmt.Sprintf("record length %d exceeds the %d bytes left in the file", e.Length, e.Limit)
+	}
+	return fmt.Sprintf("record length %d exceeds the maximum record size of %d bytes", e.Length, e.Limit)
+}
+
+// Is reports whether the error matches ErrCorruptRecord or
+// io.ErrUnexpectedEOF.
+func (e *RecordTooLargeError) Is(target error) bool {
+	return e.PastEOF && (target == ErrCorruptRecord || target == io.ErrUnexpectedEOF)
 }
 
 // NewReader returns a new instance of a record reader which accepts a queue of
-// files to read from.
+// files to read from. Every file in the queue is decompressed using
+// options.CompressionType; use CompressionTypeAuto to read a queue of files
+// with different compression types.
 func NewReader(queue []string, options *RecordReaderOptions) (*RecordReader, error) {
+	if options == nil {
+		options = &RecordReaderOptions{}
+	}
 	return &RecordReader{
 		queue:   queue,
 		options: options,
@@ -38,11 +148,131 @@ func NewReader(queue []string, options *RecordReaderOptions) (*RecordReader, err
 	}, nil
 }
 
+// NewReaderFrom returns a record reader that reads the records of a single
+// TFRecord stream from r, decompressing it using options.CompressionType.
+// CompressionTypeAuto detects the compression type from the leading bytes of
+// the stream.
+func NewReaderFrom(r io.Reader, options *RecordReaderOptions) (*RecordReader, error) {
+	if options == nil {
+		options = &RecordReaderOptions{}
+	}
+	rr := &RecordReader{
+		options: options,
+	}
+	if err := rr.startStream(r, ""); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// open opens a file from the queue using the configured opener.
+func (rr *RecordReader) open(filename string) (io.ReadCloser, error) {
+	if rr.options.Opener != nil {
+		return rr.options.Opener(filename)
+	}
+	return os.Open(filename)
+}
+
+// startStream prepares the reader to read records from r, which holds the
+// possibly compressed contents of the named file. The filename is only used to
+// detect the compression type and may be empty. If r is empty, the reader is
+// left without a current stream.
+func (rr *RecordReader) startStream(r io.Reader, filename string) error {
+	size, sizeKnown := remainingSize(r)
+	rr.streamSize = -1
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err == io.EOF {
+		// An empty file holds no records, even if it is supposed to be
+		// compressed.
+		return nil
+	}
+	ct := rr.options.CompressionType
+	if ct == CompressionTypeAuto {
+		ct = detectCompressionType(br, filename)
+	}
+	dr, err := newDecompressor(br, ct)
+	if err != nil {
+		return err
+	}
+	rr.setStream(dr)
+	rr.decompressor = dr
+	rr.offset = 0
+	rr.uncompressed = ct == CompressionTypeNone
+	if ct == CompressionTypeNone && sizeKnown {
+		rr.streamSize = size
+	}
+	return nil
+}
+
+// setStream makes the reader read records from the decompressed stream r.
+func (rr *RecordReader) setStream(r io.Reader) {
+	rr.pushback = &pushbackReader{r: r}
+	rr.reader = bufio.NewReader(rr.pushback)
+}
+
+// remainingSize returns the number of unread bytes of r, if that can be
+// determined without reading from it.
+func remainingSize(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case *io.LimitedReader:
+		return r.N, true
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err := r.Seek(cur, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - cur, true
+	default:
+		return 0, false
+	}
+}
+
+// checkLength returns a *RecordTooLargeError if a record of the given length
+// that starts at the current offset can't be read.
+func (rr *RecordReader) checkLength(length uint64) error {
+	if max := rr.options.MaxRecordSize; max > 0 && length > uint64(max) {
+		return &RecordTooLargeError{Length: length, Limit: max}
+	}
+	if rr.streamSize >= 0 {
+		left := rr.streamSize - rr.offset - 16
+		if left < 0 {
+			left = 0
+		}
+		if length > uint64(left) {
+			return &RecordTooLargeError{Length: length, Limit: left, PastEOF: true}
+		}
+	}
+	return nil
+}
+
 // NumRecordsProduced returns the number of records that this record reader has produced.
 func (rr *RecordReader) NumRecordsProduced() int {
 	return rr.recordsProduced
 }
 
+// NumRecordsSkipped returns the number of corrupt records that this record
+// reader has skipped because of RecordReaderOptions.SkipCorruptRecords. A run
+// of corrupt bytes that ends at the next valid record counts as one record.
+func (rr *RecordReader) NumRecordsSkipped() int {
+	return rr.recordsSkipped
+}
+
+// NumBytesSkipped returns the number of bytes of corrupt records that this
+// record reader has skipped because of RecordReaderOptions.SkipCorruptRecords.
+// For compressed files, the bytes are counted after decompression.
+func (rr *RecordReader) NumBytesSkipped() int64 {
+	return rr.bytesSkipped
+}
+
 // readNextRecord will return the bytes that form the next successfully validated
 // record found in the bytestream of the underlying reader.  If the reader returns
 // an error, it is bubbled up (io.EOF is also an error, but just indicates that
@@ -53,25 +283,13 @@ func (rr *RecordReader) readNextRecord() ([]byte, error) {
 		return nil, io.EOF
 	}
 
-	hbs, err := rr.reader.Peek(12)
-	if err != nil {
-		return nil, err
-	}
-
-	// Read the first 12 bytes into the entry structure and validate the length
-	// field's CRC.
 	var rec recordEntry
-	if err := binary.Read(rr.reader, binary.LittleEndian, &rec.length); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(rr.reader, binary.LittleEndian, &rec.lengthCrc); err != nil {
+	var err error
+	rec.length, err = rr.readHeader()
+	if err != nil {
 		return nil, err
 	}
 
-	if MaskedCRC(hbs, 8) != rec.lengthCrc {
-		return nil, errors.New("crc mismatch on record length")
-	}
-
 	// Read the length number of fields into the length array.
 	offset := uint64(0)
 	for offset < rec.length {
@@ -81,58 +299,537 @@ func (rr *RecordReader) readNextRecord() ([]byte, error) {
 		}
 		chunk := make([]byte, left)
 		n, err := rr.reader.Read(chunk)
+		rec.data = append(rec.data, chunk[:n]...)
+		offset += uint64(n)
+		rr.offset += int64(n)
+		if err == io.EOF {
+			return nil, fmt.Errorf("record data ends after %d of %d bytes: %w", offset, rec.length, errTruncatedRecord)
+		}
 		if err != nil {
 			return nil, err
 		}
-
-		rec.data = append(rec.data, chunk[:n]...)
-		offset += uint64(n)
 	}
 
-	if err := binary.Read(rr.reader, binary.LittleEndian, &rec.dataCrc); err != nil {
+	var crcBytes [4]byte
+	n, err := io.ReadFull(rr.reader, crcBytes[:])
+	rr.offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("record data checksum is missing: %w", errTruncatedRecord)
+	}
+	if err != nil {
 		return nil, err
 	}
+	rec.dataCrc = binary.LittleEndian.Uint32(crcBytes[:])
 	if MaskedCRC(rec.data, int64(rec.length)) != rec.dataCrc {
-		return nil, errors.New("crc mismatch on data")
+		return nil, fmt.Errorf("crc mismatch on data: %w", ErrCorruptRecord)
 	}
 
 	return rec.data, nil
 }
 
+// readHeader reads the 12 byte header of the next record from the current
+// stream and returns the length of its data. The header is only consumed if
+// its length checksum matches, so that the reader can scan for the next record
+// from the following byte. It returns io.EOF only if the stream ends before
+// the header.
+func (rr *RecordReader) readHeader() (uint64, error) {
+	hbs, err := rr.reader.Peek(12)
+	if err == io.EOF && len(hbs) > 0 {
+		return 0, fmt.Errorf("record header ends after %d of 12 bytes: %w", len(hbs), errTruncatedRecord)
+	}
+	if err != nil {
+		return 0, err
+	}
+	length := binary.LittleEndian.Uint64(hbs)
+	if MaskedCRC(hbs, 8) != binary.LittleEndian.Uint32(hbs[8:]) {
+		return 0, fmt.Errorf("crc mismatch on record length: %w", ErrCorruptRecord)
+	}
+	if err := rr.checkLength(length); err != nil {
+		return 0, err
+	}
+	if _, err := rr.reader.Discard(12); err != nil {
+		return 0, err
+	}
+	rr.offset += 12
+	return length, nil
+}
+
+// readValidRecord is like readNextRecord, but skips corrupt records if the
+// reader is configured to.
+func (rr *RecordReader) readValidRecord() ([]byte, error) {
+	for {
+		start := rr.offset
+		bs, err := rr.readNextRecord()
+		if !rr.options.SkipCorruptRecords || !errors.Is(err, ErrCorruptRecord) {
+			return bs, err
+		}
+		if err := rr.skipCorruptRecord(start); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readValidHeader is like readHeader, but skips records with corrupt headers
+// if the reader is configured to.
+func (rr *RecordReader) readValidHeader() (uint64, error) {
+	for {
+		start := rr.offset
+		length, err := rr.readHeader()
+		if !rr.options.SkipCorruptRecords || !errors.Is(err, ErrCorruptRecord) {
+			return length, err
+		}
+		if err := rr.skipCorruptRecord(start); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// skipCorruptRecord skips the corrupt record that starts at offset start of
+// the current stream, leaving the reader at the start of the next valid
+// record. It returns io.EOF if no valid record follows.
+func (rr *RecordReader) skipCorruptRecord(start int64) error {
+	rr.recordsSkipped++
+
+	// A record with a corrupt length is left unread, and its length can't be
+	// trusted, so look for the next record from the following byte. A record
+	// with corrupt data has been read in full, so the next record should
+	// start right after it.
+	if rr.offset == start {
+		if _, err := rr.reader.Discard(1); err != nil {
+			return err
+		}
+		rr.offset++
+	}
+	_, err := rr.SkipToRecordBoundary(-1)
+	if err == io.EOF {
+		// No valid record follows, so skip the rest of the stream.
+		var n int64
+		n, err = io.Copy(io.Discard, rr.reader)
+		rr.offset += n
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	rr.bytesSkipped += rr.offset - start
+	return err
+}
+
+// ErrNoRecordBoundary is returned by SkipToRecordBoundary when no valid record
+// starts within the search limit.
+var ErrNoRecordBoundary = errors.New("no record boundary found")
+
+// SkipToRecordBoundary discards bytes from the current stream until the reader
+// is positioned at the start of a valid record, which is one whose length and
+// data checksums both match. It returns the number of bytes discarded.
+//
+// This allows reading an uncompressed TFRecord file starting from an
+// arbitrary byte offset, such as the start of a split of a large file. At most
+// limit bytes are discarded, or any number if limit is negative; if no record
+// starts within limit bytes, ErrNoRecordBoundary is returned. If the stream
+// ends before a record is found, io.EOF is returned.
+//
+// Checking the data checksum requires reading the whole record ahead, so
+// records longer than 64 MiB, or than RecordReaderOptions.MaxRecordSize if
+// that is larger, are skipped like corrupt ones.
+func (rr *RecordReader) SkipToRecordBoundary(limit int64) (int64, error) {
+	return rr.skipUntil(limit, rr.atRecordBoundary)
+}
+
+// SkipToRecordHeader is like SkipToRecordBoundary, but stops at the first
+// header whose length checksum matches and whose length fits in the rest of
+// the stream, without reading the record's data. A corrupt record that starts
+// there is then reported by the next read, rather than silently skipped.
+//
+// Random bytes match the length checksum once in 2^32 offsets, but they are
+// very unlikely to also hold a length that fits in the stream, so the check is
+// reliable when the size of the stream is known, such as for uncompressed
+// files that can seek.
+func (rr *RecordReader) SkipToRecordHeader(limit int64) (int64, error) {
+	return rr.skipUntil(limit, rr.atRecordHeader)
+}
+
+// skipUntil discards bytes from the current stream, at most limit unless it is
+// negative, until found reports true.
+func (rr *RecordReader) skipUntil(limit int64, found func() (bool, error)) (int64, error) {
+	if rr.reader == nil {
+		return 0, io.EOF
+	}
+	var skipped int64
+	for limit < 0 || skipped < limit {
+		ok, err := found()
+		if err != nil {
+			return skipped, err
+		}
+		if ok {
+			return skipped, nil
+		}
+		if _, err := rr.reader.Discard(1); err != nil {
+			return skipped, err
+		}
+		skipped++
+		rr.offset++
+	}
+	return skipped, ErrNoRecordBoundary
+}
+
+// maxBoundaryCheckSize is the length of the longest record whose data
+// checksum atRecordBoundary reads ahead to check, unless MaxRecordSize is
+// larger.
+const maxBoundaryCheckSize = 64 << 20
+
+// atRecordHeader reports whether the current stream is positioned at a record
+// header whose length checksum matches and whose length could be read, without
+// consuming any bytes.
+func (rr *RecordReader) atRecordHeader() (bool, error) {
+	_, ok, err := rr.peekHeader()
+	return ok, err
+}
+
+// peekHeader is like atRecordHeader, but also returns the length of the
+// record.
+func (rr *RecordReader) peekHeader() (uint64, bool, error) {
+	hbs, err := rr.reader.Peek(12)
+	if err != nil {
+		return 0, false, err
+	}
+	if MaskedCRC(hbs, 8) != binary.LittleEndian.Uint32(hbs[8:12]) {
+		return 0, false, nil
+	}
+	length := binary.LittleEndian.Uint64(hbs)
+	if length > math.MaxInt64-16 || errors.Is(rr.checkLength(length), ErrCorruptRecord) {
+		return 0, false, nil
+	}
+	return length, true, nil
+}
+
+// atRecordBoundary reports whether the current stream is positioned at the
+// start of a valid record without consuming any bytes.
+func (rr *RecordReader) atRecordBoundary() (bool, error) {
+	length, ok, err := rr.peekHeader()
+	if !ok || err != nil {
+		return false, err
+	}
+
+	// Random bytes pass the length checksum once in 2^32 offsets, which is
+	// too often for files that are many gigabytes long. Confirm the boundary
+	// by checking the data checksum, then put the bytes back.
+	limit := int64(maxBoundaryCheckSize)
+	if rr.options.MaxRecordSize > limit {
+		limit = rr.options.MaxRecordSize
+	}
+	if length > uint64(limit) {
+		return false, nil
+	}
+	n := int(length) + 16
+	if n <= rr.reader.Size() {
+		bs, err := rr.reader.Peek(n)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		return err == nil && recordDataMatches(bs, length), nil
+	}
+
+	bs := make([]byte, n)
+	m, err := io.ReadFull(rr.reader, bs)
+	rr.unread(bs[:m])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return recordDataMatches(bs, length), nil
+}
+
+// recordDataMatches reports whether the data checksum of the encoded record bs
+// matches its data.
+func recordDataMatches(bs []byte, length uint64) bool {
+	return MaskedCRC(bs[12:], int64(length)) == binary.LittleEndian.Uint32(bs[12+length:])
+}
+
+// unread puts bs back in front of the bytes that the current stream hasn't
+// returned yet.
+func (rr *RecordReader) unread(bs []byte) {
+	buffered, _ := rr.reader.Peek(rr.reader.Buffered())
+	pending := make([]byte, 0, len(bs)+len(buffered)+len(rr.pushback.buf))
+	pending = append(pending, bs...)
+	pending = append(pending, buffered...)
+	pending = append(pending, rr.pushback.buf...)
+	rr.pushback.buf = pending
+	rr.reader.Reset(rr.pushback)
+}
+
 // ReadRecord checks the record reader for additional records and returns the next
 // available one.  If the current reader returns an EOF, the queue is dequeued for
 // another file to parse.  If the queue is empty, ReadRecord returns io.EOF to the
 // caller.
 func (rr *RecordReader) ReadRecord() ([]byte, error) {
+	var bs []byte
+	err := rr.nextRecord(func() (err error) {
+		bs, err = rr.readValidRecord()
+		return err
+	})
+	if err == nil {
+		rr.recordsProduced++
+	}
+	return bs, err
+}
+
+// NextRecordReader is like ReadRecord, but returns a reader of the next
+// record's data and its length instead of reading the whole record into
+// memory. The data checksum is checked once the reader reaches the end of the
+// record: if it doesn't match, the reader returns an error wrapping
+// ErrCorruptRecord instead of io.EOF.
+//
+// The returned reader is only valid until the next call to ReadRecord or
+// NextRecordReader, which skip any part of the record that wasn't read. A
+// corrupt checksum of a record that wasn't read to the end is then returned
+// by that call, unless the reader skips corrupt records.
+//
+// A record only counts towards NumRecordsProduced once its checksum has
+// matched. Since its data is returned before the checksum is checked, a
+// reader that skips corrupt records still returns the data of a record with a
+// corrupt data checksum, followed by the error. The record is then counted as
+// skipped, and the next call resumes from the next valid record.
+func (rr *RecordReader) NextRecordReader() (io.Reader, int64, error) {
+	var r *recordDataReader
+	err := rr.nextRecord(func() error {
+		length, err := rr.readValidHeader()
+		if err != nil {
+			return err
+		}
+		r = &recordDataReader{
+			rr:        rr,
+			start:     rr.offset - 12,
+			length:    int64(length),
+			remaining: int64(length),
+			crc:       crc32.New(crc),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	rr.recordStream = r
+	return r, r.length, nil
+}
+
+// nextRecord calls read to read the next record from the current stream,
+// moving on to the next file in the queue whenever the current stream ends.
+func (rr *RecordReader) nextRecord(read func() error) error {
+	if rr.closed {
+		return errReaderClosed
+	}
+	if err := rr.finishRecordStream(); err != nil {
+		return err
+	}
 	for {
 		// If the reader is empty, and the queue has items - open the next item
 		if rr.reader == nil && len(rr.queue) > 0 {
 			var nextfp string
 			nextfp, rr.queue = rr.queue[0], rr.queue[1:]
-			f, err := os.Open(nextfp)
+			f, err := rr.open(nextfp)
 			if err != nil {
-				return nil, err
+				rr.fileIndex++
+				return err
+			}
+			if err := rr.startStream(f, nextfp); err != nil {
+				f.Close()
+				rr.fileIndex++
+				return fmt.Errorf("error opening %s: %w", nextfp, err)
 			}
-			rr.reader = bufio.NewReader(f)
+			if rr.reader == nil {
+				f.Close()
+				rr.fileIndex++
+				continue
+			}
+			rr.file, rr.filename = f, nextfp
 		}
 
 		// If the reader is nil - we are done, return io.EOF to signal we are done with
 		// the last item in the queue.
 		if rr.reader == nil {
-			return nil, io.EOF
+			return io.EOF
 		}
 
 		// Attempt to read an item off the reader, if we get an EOF - we need to try
 		// and dequeue another work-item off the queue.
-		bs, err := rr.readNextRecord()
+		err := read()
 		if err == io.EOF {
-			rr.reader = nil
+			// Release the file as soon as it has been read, rather than
+			// when the reader is closed.
+			rr.fileIndex++
+			if err := rr.closeStream(); err != nil {
+				return err
+			}
 			continue
-		} else if err == nil {
-			rr.recordsProduced += 1
 		}
 
 		// Got a record (or an error), bubble up and done.
-		return bs, err
+		return err
+	}
+}
+
+// errReaderClosed is returned by the methods of a closed reader.
+var errReaderClosed = errors.New("record reader is closed")
+
+// closeStream closes the current stream and the file from the queue that it
+// reads, if any.
+func (rr *RecordReader) closeStream() error {
+	var err error
+	if rr.decompressor != nil {
+		err = rr.decompressor.Close()
+	}
+	if rr.file != nil {
+		if closeErr := rr.file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			err = fmt.Errorf("error closing %s: %w", rr.filename, err)
+		}
+	}
+	rr.reader, rr.decompressor, rr.pushback = nil, nil, nil
+	rr.file, rr.filename = nil, ""
+	rr.offset, rr.streamSize = 0, -1
+	return err
+}
+
+// Close closes the file that the reader is reading, if any, and discards the
+// rest of the queue. Readers created with NewReaderFrom or NewIndexedReader
+// don't close their underlying reader. The reader may not be used after it is
+// closed, and a reader of a record returned by NextRecordReader returns an
+// error once it is.
+func (rr *RecordReader) Close() error {
+	if rr.closed {
+		return errors.New("record reader is already closed")
+	}
+	rr.closed = true
+	rr.queue = nil
+	if r := rr.recordStream; r != nil && r.err == nil {
+		// The record's reader can't read from the stream once it is closed.
+		r.err = errReaderClosed
+	}
+	rr.recordStream = nil
+	return rr.closeStream()
+}
+
+// CurrentFile returns the name of the file from the queue that records are
+// being read from, or "" if no file is open. Readers created with
+// NewReaderFrom or NewIndexedReader have no current file.
+func (rr *RecordReader) CurrentFile() string {
+	return rr.filename
+}
+
+// CurrentOffset returns the number of bytes that have been read from the
+// current file or stream, or 0 if there is none. For compressed files, the
+// offset is in the decompressed stream.
+func (rr *RecordReader) CurrentOffset() int64 {
+	return rr.offset
+}
+
+// NumFilesRemaining returns the number of files in the queue that haven't
+// been opened yet, not counting the current file.
+func (rr *RecordReader) NumFilesRemaining() int {
+	return len(rr.queue)
+}
+
+// finishRecordStream reads the rest of the record returned by the last call to
+// NextRecordReader, if any, so that the reader is positioned at the next
+// record.
+func (rr *RecordReader) finishRecordStream() error {
+	r := rr.recordStream
+	if r == nil {
+		return nil
+	}
+	rr.recordStream = nil
+
+	reported := r.err != nil
+	_, err := io.Copy(io.Discard, r)
+	if errors.Is(err, ErrCorruptRecord) && rr.options.SkipCorruptRecords {
+		// Like readValidRecord, scan for the next valid record, which
+		// normally starts right after the corrupt one.
+		if err := rr.skipCorruptRecord(r.start); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	}
+	if reported {
+		// The caller has already seen the error.
+		return nil
+	}
+	return err
+}
+
+// recordDataReader reads the data of a record from the current stream of a
+// RecordReader and checks its checksum at the end.
+type recordDataReader struct {
+	rr *RecordReader
+	// start is the offset of the record's header in the stream.
+	start     int64
+	length    int64
+	remaining int64
+	crc       hash.Hash32
+	// err is returned by all reads once it is set. It is io.EOF once the
+	// data has been read and its checksum matched.
+	err error
+}
+
+func (r *recordDataReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remaining == 0 {
+		r.err = r.readChecksum()
+		return 0, r.err
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.rr.reader.Read(p)
+	r.crc.Write(p[:n])
+	r.remaining -= int64(n)
+	r.rr.offset += int64(n)
+	if err == io.EOF {
+		err = fmt.Errorf("record data ends after %d of %d bytes: %w", r.length-r.remaining, r.length, errTruncatedRecord)
+	}
+	if err == nil && r.remaining == 0 {
+		err = r.readChecksum()
+	}
+	r.err = err
+	return n, err
+}
+
+// readChecksum reads the data checksum that follows the data and returns
+// io.EOF if it matches.
+func (r *recordDataReader) readChecksum() error {
+	var bs [4]byte
+	n, err := io.ReadFull(r.rr.reader, bs[:])
+	r.rr.offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("record data checksum is missing: %w", errTruncatedRecord)
+	}
+	if err != nil {
+		return err
+	}
+	if CRCMask(r.crc.Sum32()) != binary.LittleEndian.Uint32(bs[:]) {
+		return fmt.Errorf("crc mismatch on data: %w", ErrCorruptRecord)
+	}
+	r.rr.recordsProduced++
+	return io.EOF
+}
+
+// pushbackReader reads buf before reading r.
+type pushbackReader struct {
+	buf []byte
+	r   io.Reader
+}
+
+func (p *pushbackReader) Read(bs []byte) (int, error) {
+	if len(p.buf) > 0 {
+		n := copy(bs, p.buf)
+		p.buf = p.buf[n:]
+		return n, nil
 	}
+	return p.r.Read(bs)
 }
@@ -0,0 +1,593 @@
+package tfrecord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// encodeWithOffsets returns records as an uncompressed TFRecord stream and the
+// offset of each record in it.
+func encodeWithOffsets(t *testing.T, records [][]byte) ([]byte, []int) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriterFrom(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int
+	for _, r := range records {
+		offsets = append(offsets, buf.Len())
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes(), offsets
+}
+
+// without returns records without the records at the given indices.
+func without(records [][]byte, indices ...int) [][]byte {
+	skip := map[int]bool{}
+	for _, i := range indices {
+		skip[i] = true
+	}
+	var out [][]byte
+	for i, r := range records {
+		if !skip[i] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestReadRecordCorruptStrict(t *testing.T) {
+	records := testRecords(5)
+	for _, test := range []struct {
+		name    string
+		corrupt func(data []byte, offset int)
+	}{
+		{"length", func(data []byte, offset int) { data[offset+3] ^= 1 }},
+		{"length checksum", func(data []byte, offset int) { data[offset+9] ^= 1 }},
+		{"data", func(data []byte, offset int) { data[offset+14] ^= 1 }},
+	} {
+		data, offsets := encodeWithOffsets(t, records)
+		test.corrupt(data, offsets[2])
+		rr, err := NewReaderFrom(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := rr.ReadRecord(); err != nil {
+				t.Fatalf("corrupt %s: error reading record %d: %v", test.name, i, err)
+			}
+		}
+		if _, err := rr.ReadRecord(); !errors.Is(err, ErrCorruptRecord) {
+			t.Errorf("corrupt %s: ReadRecord returned %v, want %v", test.name, err, ErrCorruptRecord)
+		}
+	}
+}
+
+func TestReadRecordSkipCorrupt(t *testing.T) {
+	records := testRecords(10)
+	data, offsets := encodeWithOffsets(t, records)
+	// Corrupt the length of record 2 and the data of record 5, and insert
+	// garbage before record 8, which is skipped as part of record 7.
+	data[offsets[2]+3] ^= 1
+	data[offsets[5]+14] ^= 1
+	garbage := []byte("garbage")
+	data = append(data[:offsets[8]:offsets[8]], append(garbage, data[offsets[8]:]...)...)
+	data[offsets[7]+14] ^= 1
+
+	rr, err := NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{SkipCorruptRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readAll(t, rr), without(records, 2, 5, 7); !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+	if got, want := rr.NumRecordsSkipped(), 3; got != want {
+		t.Errorf("NumRecordsSkipped() = %d, want %d", got, want)
+	}
+	wantBytes := int64(len(records[2])+len(records[5])+len(records[7])+3*16) + int64(len(garbage))
+	if got := rr.NumBytesSkipped(); got != wantBytes {
+		t.Errorf("NumBytesSkipped() = %d, want %d", got, wantBytes)
+	}
+	if got, want := rr.NumRecordsProduced(), 7; got != want {
+		t.Errorf("NumRecordsProduced() = %d, want %d", got, want)
+	}
+}
+
+func TestReadRecordSkipCorruptToEOF(t *testing.T) {
+	records := testRecords(4)
+	data, offsets := encodeWithOffsets(t, records)
+	data[offsets[3]+3] ^= 1
+
+	rr, err := NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{SkipCorruptRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readAll(t, rr), records[:3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+	if got, want := rr.NumBytesSkipped(), int64(len(data)-offsets[3]); got != want {
+		t.Errorf("NumBytesSkipped() = %d, want %d", got, want)
+	}
+}
+
+func TestReadRecordSkipCorruptCompressed(t *testing.T) {
+	records := testRecords(6)
+	data, offsets := encodeWithOffsets(t, records)
+	data[offsets[1]+14] ^= 1
+
+	// Compress the corrupt stream so that the corruption is only visible
+	// after decompression.
+	var buf bytes.Buffer
+	c, err := newCompressor(&buf, CompressionTypeGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewReaderFrom(&buf, &RecordReaderOptions{CompressionType: CompressionTypeAuto, SkipCorruptRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readAll(t, rr), without(records, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+}
+
+func TestSkipToRecordBoundary(t *testing.T) {
+	records := testRecords(5)
+	data, offsets := encodeWithOffsets(t, records)
+
+	rr, err := NewReaderFrom(bytes.NewReader(data[offsets[1]+5:]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := rr.SkipToRecordBoundary(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(offsets[2] - offsets[1] - 5); skipped != want {
+		t.Errorf("SkipToRecordBoundary skipped %d bytes, want %d", skipped, want)
+	}
+	if got, want := readAll(t, rr), records[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+
+	rr, err = NewReaderFrom(bytes.NewReader(data[offsets[1]+5:]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.SkipToRecordBoundary(3); err != ErrNoRecordBoundary {
+		t.Errorf("SkipToRecordBoundary(3) returned %v, want %v", err, ErrNoRecordBoundary)
+	}
+}
+
+func TestSkipToRecordBoundaryLongRecord(t *testing.T) {
+	// A record that doesn't fit in the read buffer has to be read ahead and
+	// put back to check its data checksum.
+	records := [][]byte{bytes.Repeat([]byte("a"), 100), bytes.Repeat([]byte("b"), 50000), []byte("c")}
+	data, offsets := encodeWithOffsets(t, records)
+
+	rr, err := NewReaderFrom(struct{ *bytes.Reader }{bytes.NewReader(data[50:])}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		skipped, err := rr.SkipToRecordBoundary(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(offsets[1] - 50); i == 0 && skipped != want {
+			t.Errorf("SkipToRecordBoundary skipped %d bytes, want %d", skipped, want)
+		}
+		if i > 0 && skipped != 0 {
+			t.Errorf("SkipToRecordBoundary at a record boundary skipped %d bytes", skipped)
+		}
+	}
+	if got, want := readAll(t, rr), records[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("read %d records, want %d", len(got), len(want))
+	}
+}
+
+// header returns a record header with a valid checksum for length.
+func header(length uint64) []byte {
+	h := make([]byte, 12)
+	binary.LittleEndian.PutUint64(h, length)
+	binary.LittleEndian.PutUint32(h[8:], MaskedCRC(h, 8))
+	return h
+}
+
+func TestReadRecordMaxRecordSize(t *testing.T) {
+	records := [][]byte{[]byte("small"), bytes.Repeat([]byte("x"), 1000), []byte("small again")}
+	data, _ := encodeWithOffsets(t, records)
+
+	rr, err := NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{MaxRecordSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.ReadRecord(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = rr.ReadRecord()
+	var tooLarge *RecordTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Length != 1000 || tooLarge.Limit != 100 || tooLarge.PastEOF {
+		t.Fatalf("ReadRecord of a record longer than MaxRecordSize returned %v", err)
+	}
+	if errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("error for a record longer than MaxRecordSize matches ErrCorruptRecord: %v", err)
+	}
+
+	// Records that are too large aren't corrupt, so they aren't skipped.
+	rr, err = NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{MaxRecordSize: 100, SkipCorruptRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.ReadRecord()
+	if _, err := rr.ReadRecord(); !errors.As(err, &tooLarge) {
+		t.Errorf("ReadRecord of a record longer than MaxRecordSize returned %v when skipping corrupt records", err)
+	}
+}
+
+func TestReadRecordLengthPastEOF(t *testing.T) {
+	// A header with a valid checksum but a huge length must not make the
+	// reader allocate memory for it.
+	records := testRecords(3)
+	data, _ := encodeWithOffsets(t, records)
+	data = append(append(header(1<<62), "short"...), data...)
+
+	rr, err := NewReaderFrom(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rr.ReadRecord()
+	var tooLarge *RecordTooLargeError
+	if !errors.As(err, &tooLarge) || !tooLarge.PastEOF || !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("ReadRecord of a record longer than the stream returned %v", err)
+	}
+
+	rr, err = NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{SkipCorruptRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, rr); !reflect.DeepEqual(got, records) {
+		t.Errorf("read %q, want %q", got, records)
+	}
+	if got, want := rr.NumBytesSkipped(), int64(12+len("short")); got != want {
+		t.Errorf("NumBytesSkipped() = %d, want %d", got, want)
+	}
+}
+
+func TestNextRecordReaderSkipCorrupt(t *testing.T) {
+	records := testRecords(6)
+	data, offsets := encodeWithOffsets(t, records)
+	// Corrupt the data of record 2 and put garbage after it.
+	data[offsets[2]+14] ^= 1
+	garbage := []byte("garbage")
+	data = append(data[:offsets[3]:offsets[3]], append(garbage, data[offsets[3]:]...)...)
+
+	rr, err := NewReaderFrom(bytes.NewReader(data), &RecordReaderOptions{SkipCorruptRecords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]byte
+	for i := 0; ; i++ {
+		r, length, err := rr.NextRecordReader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 4 {
+			// Leave a record unread, which skips the rest of it.
+			continue
+		}
+		bs, err := io.ReadAll(r)
+		if int64(len(bs)) != length {
+			t.Errorf("record %d has %d bytes, but its length is %d", i, len(bs), length)
+		}
+		if errors.Is(err, ErrCorruptRecord) {
+			// The data of a corrupt record is returned before its
+			// checksum is checked.
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, bs)
+	}
+
+	if want := without(records, 2, 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("read %q, want %q", got, want)
+	}
+	if got, want := rr.NumRecordsProduced(), 5; got != want {
+		t.Errorf("NumRecordsProduced() = %d, want %d", got, want)
+	}
+	if got, want := rr.NumRecordsSkipped(), 1; got != want {
+		t.Errorf("NumRecordsSkipped() = %d, want %d", got, want)
+	}
+	if got, want := rr.NumBytesSkipped(), int64(len(records[2])+16+len(garbage)); got != want {
+		t.Errorf("NumBytesSkipped() = %d, want %d", got, want)
+	}
+}
+
+func TestReadRecordTruncated(t *testing.T) {
+	records := testRecords(3)
+	data, offsets := encodeWithOffsets(t, records)
+	last := offsets[2]
+	dataLen := len(records[2])
+	for _, test := range []struct {
+		name string
+		size int
+	}{
+		{"1 header byte", last + 1},
+		{"11 header bytes", last + 11},
+		{"part of the data", last + 12 + dataLen/2},
+		{"no data checksum", last + 12 + dataLen},
+		{"part of the data checksum", last + 12 + dataLen + 2},
+	} {
+		truncated := data[:test.size]
+		for _, src := range []struct {
+			name string
+			r    func() io.Reader
+		}{
+			// The size of a bytes.Reader is known; the size of the
+			// struct that hides its methods isn't.
+			{"sized", func() io.Reader { return bytes.NewReader(truncated) }},
+			{"unsized", func() io.Reader { return struct{ io.Reader }{bytes.NewReader(truncated)} }},
+		} {
+			name := test.name + " " + src.name
+			rr, err := NewReaderFrom(src.r(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := rr.ReadRecord(); err != nil {
+					t.Fatalf("%s: error reading record %d: %v", name, i, err)
+				}
+			}
+			_, err = rr.ReadRecord()
+			if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrCorruptRecord) {
+				t.Errorf("%s: ReadRecord returned %v, want %v matching %v", name, err, io.ErrUnexpectedEOF, ErrCorruptRecord)
+			}
+
+			rr, err = NewReaderFrom(src.r(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = nil
+			for i := 0; i < 3 && err == nil; i++ {
+				var r io.Reader
+				r, _, err = rr.NextRecordReader()
+				if err == nil {
+					_, err = io.ReadAll(r)
+				}
+			}
+			if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrCorruptRecord) {
+				t.Errorf("%s: reading the last record with NextRecordReader returned %v, want %v", name, err, io.ErrUnexpectedEOF)
+			}
+
+			rr, err = NewReaderFrom(src.r(), &RecordReaderOptions{SkipCorruptRecords: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := readAll(t, rr), records[:2]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: read %q, want %q", name, got, want)
+			}
+			if got := rr.NumRecordsSkipped(); got != 1 {
+				t.Errorf("%s: NumRecordsSkipped() = %d, want 1", name, got)
+			}
+			if got, want := rr.NumBytesSkipped(), int64(test.size-last); got != want {
+				t.Errorf("%s: NumBytesSkipped() = %d, want %d", name, got, want)
+			}
+		}
+	}
+}
+
+func TestReadRecordTruncatedFile(t *testing.T) {
+	records := testRecords(3)
+	data, _ := encodeWithOffsets(t, records)
+	path := filepath.Join(t.TempDir(), "truncated.tfrecord")
+	if err := os.WriteFile(path, data[:len(data)-15], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewReader([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := rr.ReadRecord(); err != nil {
+			t.Fatalf("error reading record %d: %v", i, err)
+		}
+	}
+	if _, err := rr.ReadRecord(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading a truncated file returned %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// memOpener is a RecordReaderOptions.Opener that serves files from memory and
+// keeps track of the handles that are open.
+type memOpener struct {
+	files  map[string][]byte
+	opened []string
+	open   int
+}
+
+func (o *memOpener) Open(filename string) (io.ReadCloser, error) {
+	data, ok := o.files[filename]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	o.opened = append(o.opened, filename)
+	o.open++
+	return &memFile{Reader: bytes.NewReader(data), o: o}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	o      *memOpener
+	closed bool
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return errors.New("file is already closed")
+	}
+	f.closed = true
+	f.o.open--
+	return nil
+}
+
+// memQueue returns an opener that serves one file of records per compression
+// type in compressionTypes, the queue of those files, and the records they
+// hold, in order.
+func memQueue(t *testing.T, perFile int) (*memOpener, []string, [][]byte) {
+	t.Helper()
+	o := &memOpener{files: map[string][]byte{}}
+	var queue []string
+	var all [][]byte
+	for _, ct := range compressionTypes {
+		records := testRecords(perFile)
+		filename := "mem/" + ct.String() + ".tfrecord" + ct.Extension()
+		o.files[filename] = encode(t, ct, records)
+		queue = append(queue, filename)
+		all = append(all, records...)
+	}
+	return o, queue, all
+}
+
+func TestReaderOpener(t *testing.T) {
+	o, queue, records := memQueue(t, 10)
+	rr, err := NewReader(queue, &RecordReaderOptions{CompressionType: CompressionTypeAuto, Opener: o.Open})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, rr); !reflect.DeepEqual(got, records) {
+		t.Errorf("read %d records that don't match the %d written", len(got), len(records))
+	}
+	if !reflect.DeepEqual(o.opened, queue) {
+		t.Errorf("opened %q, want %q", o.opened, queue)
+	}
+	if o.open != 0 {
+		t.Errorf("%d files are still open after reading the queue", o.open)
+	}
+
+	rr, err = NewReader([]string{"mem/missing"}, &RecordReaderOptions{Opener: o.Open})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.ReadRecord(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadRecord of a missing file returned %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestReaderClosesFilesAtEOF(t *testing.T) {
+	o, queue, records := memQueue(t, 3)
+	o.files["mem/empty.tfrecord.gz"] = nil
+	queue = append(queue[:1:1], append([]string{"mem/empty.tfrecord.gz"}, queue[1:]...)...)
+	rr, err := NewReader(queue, &RecordReaderOptions{CompressionType: CompressionTypeAuto, Opener: o.Open})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.CurrentFile() != "" || rr.CurrentOffset() != 0 || rr.NumFilesRemaining() != len(queue) {
+		t.Errorf("before reading: CurrentFile() = %q, CurrentOffset() = %d, NumFilesRemaining() = %d", rr.CurrentFile(), rr.CurrentOffset(), rr.NumFilesRemaining())
+	}
+
+	nonEmpty := append(queue[:1:1], queue[2:]...)
+	for i := range records {
+		if _, err := rr.ReadRecord(); err != nil {
+			t.Fatal(err)
+		}
+		file := i / 3
+		if got, want := rr.CurrentFile(), nonEmpty[file]; got != want {
+			t.Errorf("CurrentFile() after record %d = %q, want %q", i, got, want)
+		}
+		var wantOffset int64
+		for _, r := range records[file*3 : i+1] {
+			wantOffset += int64(len(r)) + 16
+		}
+		if got := rr.CurrentOffset(); got != wantOffset {
+			t.Errorf("CurrentOffset() after record %d = %d, want %d", i, got, wantOffset)
+		}
+		wantRemaining := len(queue) - file - 1
+		if file > 0 {
+			// The empty file after the first one has been opened and
+			// closed as well.
+			wantRemaining--
+		}
+		if got := rr.NumFilesRemaining(); got != wantRemaining {
+			t.Errorf("NumFilesRemaining() after record %d = %d, want %d", i, got, wantRemaining)
+		}
+		if o.open != 1 {
+			t.Errorf("%d files are open after record %d, want 1", o.open, i)
+		}
+	}
+
+	if _, err := rr.ReadRecord(); err != io.EOF {
+		t.Fatalf("ReadRecord at the end of the queue returned %v, want io.EOF", err)
+	}
+	if o.open != 0 {
+		t.Errorf("%d files are still open after reading the queue", o.open)
+	}
+	if rr.CurrentFile() != "" || rr.CurrentOffset() != 0 || rr.NumFilesRemaining() != 0 {
+		t.Errorf("after reading: CurrentFile() = %q, CurrentOffset() = %d, NumFilesRemaining() = %d", rr.CurrentFile(), rr.CurrentOffset(), rr.NumFilesRemaining())
+	}
+	if !reflect.DeepEqual(o.opened, queue) {
+		t.Errorf("opened %q, want %q", o.opened, queue)
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	o, queue, _ := memQueue(t, 3)
+	rr, err := NewReader(queue, &RecordReaderOptions{CompressionType: CompressionTypeAuto, Opener: o.Open})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := rr.NextRecordReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if o.open != 0 {
+		t.Errorf("%d files are still open after Close", o.open)
+	}
+	if len(o.opened) != 1 {
+		t.Errorf("opened %q before Close, want only the first file", o.opened)
+	}
+	if rr.CurrentFile() != "" || rr.NumFilesRemaining() != 0 {
+		t.Errorf("after Close: CurrentFile() = %q, NumFilesRemaining() = %d", rr.CurrentFile(), rr.NumFilesRemaining())
+	}
+
+	if _, err := r.Read(make([]byte, 10)); err == nil || err == io.EOF {
+		t.Errorf("Read of a record after Close returned %v", err)
+	}
+	if _, err := rr.ReadRecord(); err == nil || err == io.EOF {
+		t.Errorf("ReadRecord after Close returned %v", err)
+	}
+	if _, _, err := rr.NextRecordReader(); err == nil || err == io.EOF {
+		t.Errorf("NextRecordReader after Close returned %v", err)
+	}
+	if err := rr.Close(); err == nil {
+		t.Error("second Close succeeded")
+	}
+}
@@ -0,0 +1,183 @@
+package tfrecord
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RollingWriterOptions specify the options of a RollingWriter.
+type RollingWriterOptions struct {
+	// RecordWriterOptions are the options of the writer of each file.
+	// CompressionTypeAuto infers the compression type from the name of each
+	// file.
+	RecordWriterOptions
+
+	// MaxBytes is the maximum number of bytes of encoded records in a file
+	// before a new file is started, or 0 for no limit. The limit applies to
+	// the uncompressed TFRecord encoding, which is 16 bytes larger than each
+	// record. A record that is larger than the limit is written to a file of
+	// its own.
+	MaxBytes int64
+
+	// MaxRecords is the maximum number of records in a file before a new file
+	// is started, or 0 for no limit.
+	MaxRecords int
+
+	// Suffix is appended to the name of every file after its number, such as
+	// ".tfrecord.gz".
+	Suffix string
+
+	// Creator creates the files of the writer. It defaults to creating local
+	// files, but may be set to write files elsewhere, such as to a Beam
+	// filesystem.Interface.
+	Creator func(filename string) (io.WriteCloser, error)
+}
+
+// RollingWriter writes records to a sequence of TFRecord files, starting a new
+// file whenever the current one reaches the size limits in its options. The
+// files are named prefix-00001, prefix-00002, and so on, followed by the
+// suffix in the options.
+type RollingWriter struct {
+	prefix  string
+	options *RollingWriterOptions
+
+	file         io.WriteCloser
+	filename     string
+	recordWriter *RecordWriter
+	fileBytes    int64
+
+	fileCount   int
+	closedFiles []string
+}
+
+// NewRollingWriter returns a writer that writes files whose names start with
+// prefix. No file is created until the first record is written.
+func NewRollingWriter(prefix string, options *RollingWriterOptions) (*RollingWriter, error) {
+	if options == nil {
+		options = &RollingWriterOptions{}
+	}
+	if options.MaxBytes < 0 || options.MaxRecords < 0 {
+		return nil, fmt.Errorf("invalid rolling writer limits: %d bytes, %d records", options.MaxBytes, options.MaxRecords)
+	}
+	return &RollingWriter{
+		prefix:  prefix,
+		options: options,
+	}, nil
+}
+
+// WriteRecord writes a record to the current file, first starting a new file
+// if the record would take the current file past its limits.
+func (w *RollingWriter) WriteRecord(data []byte) error {
+	size := int64(len(data)) + 16
+	if w.recordWriter != nil && w.isFull(size) {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+	}
+	if w.recordWriter == nil {
+		if err := w.openFile(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.recordWriter.WriteRecord(data); err != nil {
+		return fmt.Errorf("error writing record to %s: %w", w.filename, err)
+	}
+	w.fileBytes += size
+	return nil
+}
+
+// isFull reports whether a record of the given encoded size must be written to
+// a new file.
+func (w *RollingWriter) isFull(size int64) bool {
+	if w.options.MaxRecords > 0 && w.recordWriter.NumRecordsWritten() >= w.options.MaxRecords {
+		return true
+	}
+	return w.options.MaxBytes > 0 && w.fileBytes+size > w.options.MaxBytes
+}
+
+func (w *RollingWriter) openFile() error {
+	w.fileCount++
+	filename := fmt.Sprintf("%s-%05d%s", w.prefix, w.fileCount, w.options.Suffix)
+
+	file, err := w.create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", filename, err)
+	}
+
+	options := w.options.RecordWriterOptions
+	if options.CompressionType == CompressionTypeAuto {
+		options.CompressionType = CompressionTypeFromPath(filename)
+	}
+	if err := checkIndexable(&options); err != nil {
+		file.Close()
+		return err
+	}
+	recordWriter, err := newWriter(file, &options)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if options.WriteIndex {
+		idx, err := w.create(IndexFilename(filename))
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("error creating %s: %w", IndexFilename(filename), err)
+		}
+		recordWriter.setIndex(idx)
+	}
+
+	w.file, w.filename, w.recordWriter, w.fileBytes = file, filename, recordWriter, 0
+	return nil
+}
+
+func (w *RollingWriter) create(filename string) (io.WriteCloser, error) {
+	if w.options.Creator != nil {
+		return w.options.Creator(filename)
+	}
+	return os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
+
+func (w *RollingWriter) closeFile() error {
+	defer func() {
+		w.file, w.filename, w.recordWriter = nil, "", nil
+	}()
+
+	err := w.recordWriter.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error closing %s: %w", w.filename, err)
+	}
+	w.closedFiles = append(w.closedFiles, w.filename)
+	return nil
+}
+
+// CurrentFile returns the name of the file that records are being written to,
+// or "" if there is none.
+func (w *RollingWriter) CurrentFile() string {
+	return w.filename
+}
+
+// ClosedFiles returns the names of the files that have been finished, in the
+// order they were written.
+func (w *RollingWriter) ClosedFiles() []string {
+	return append([]string(nil), w.closedFiles...)
+}
+
+// Close finishes the current file, if any. The writer may not be used after
+// it is closed.
+func (w *RollingWriter) Close() error {
+	if w.options == nil {
+		return errors.New("rolling writer is already closed")
+	}
+	var err error
+	if w.recordWriter != nil {
+		err = w.closeFile()
+	}
+	w.options = nil
+	return err
+}
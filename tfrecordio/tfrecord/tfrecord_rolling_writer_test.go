@@ -0,0 +1,184 @@
+package tfrecord
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// memCreator is a RollingWriterOptions.Creator that writes files to memory.
+type memCreator struct {
+	files map[string][]byte
+}
+
+func (c *memCreator) Create(filename string) (io.WriteCloser, error) {
+	if _, ok := c.files[filename]; ok {
+		return nil, fmt.Errorf("%s already exists", filename)
+	}
+	c.files[filename] = nil
+	return &memWriter{filename: filename, c: c}, nil
+}
+
+type memWriter struct {
+	bytes.Buffer
+	filename string
+	c        *memCreator
+	closed   bool
+}
+
+func (w *memWriter) Close() error {
+	if w.closed {
+		return errors.New("file is already closed")
+	}
+	w.closed = true
+	w.c.files[w.filename] = w.Bytes()
+	return nil
+}
+
+// rollRecords writes records with a RollingWriter and returns the files it
+// closed and their contents.
+func rollRecords(t *testing.T, options RollingWriterOptions, records [][]byte) ([]string, map[string][]byte) {
+	t.Helper()
+	c := &memCreator{files: map[string][]byte{}}
+	options.Creator = c.Create
+	w, err := NewRollingWriter("mem/out", &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.files[w.CurrentFile()]; !ok {
+			t.Fatalf("CurrentFile returned %q, which isn't being written", w.CurrentFile())
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.CurrentFile() != "" {
+		t.Errorf("CurrentFile returned %q after Close", w.CurrentFile())
+	}
+	return w.ClosedFiles(), c.files
+}
+
+// checkRolledFiles checks that the rolled files are named in order, and that
+// they hold records split into files of the given sizes.
+func checkRolledFiles(t *testing.T, suffix string, closed []string, files map[string][]byte, records [][]byte, sizes ...int) {
+	t.Helper()
+	var want []string
+	for i := range sizes {
+		want = append(want, fmt.Sprintf("mem/out-%05d%s", i+1, suffix))
+	}
+	if !reflect.DeepEqual(closed, want) {
+		t.Fatalf("ClosedFiles = %q, want %q", closed, want)
+	}
+	if len(files) != len(want) {
+		t.Errorf("wrote %d files, want %d", len(files), len(want))
+	}
+	for i, filename := range closed {
+		rr, err := NewReaderFrom(bytes.NewReader(files[filename]), &RecordReaderOptions{CompressionType: CompressionTypeFromPath(filename)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := readAll(t, rr)
+		if !reflect.DeepEqual(got, records[:sizes[i]]) {
+			t.Errorf("%s holds %d records, want the next %d", filename, len(got), sizes[i])
+		}
+		records = records[sizes[i]:]
+	}
+}
+
+func TestRollingWriterMaxRecords(t *testing.T) {
+	records := testRecords(25)
+	closed, files := rollRecords(t, RollingWriterOptions{MaxRecords: 10}, records)
+	checkRolledFiles(t, "", closed, files, records, 10, 10, 5)
+}
+
+func TestRollingWriterMaxBytes(t *testing.T) {
+	// Each record is 26 bytes when encoded, so 3 fit in 80 bytes.
+	var records [][]byte
+	for i := 0; i < 10; i++ {
+		records = append(records, []byte(fmt.Sprintf("record %03d", i)))
+	}
+	closed, files := rollRecords(t, RollingWriterOptions{MaxBytes: 80}, records)
+	checkRolledFiles(t, "", closed, files, records, 3, 3, 3, 1)
+
+	// The limit is inclusive.
+	closed, files = rollRecords(t, RollingWriterOptions{MaxBytes: 78}, records)
+	checkRolledFiles(t, "", closed, files, records, 3, 3, 3, 1)
+
+	// Whichever limit is reached first starts a new file.
+	closed, files = rollRecords(t, RollingWriterOptions{MaxBytes: 80, MaxRecords: 2}, records)
+	checkRolledFiles(t, "", closed, files, records, 2, 2, 2, 2, 2)
+}
+
+func TestRollingWriterRecordLargerThanLimit(t *testing.T) {
+	large := bytes.Repeat([]byte{'x'}, 100)
+	small := []byte("record")
+	records := [][]byte{large, small, small, large, large, small}
+	closed, files := rollRecords(t, RollingWriterOptions{MaxBytes: 50}, records)
+	checkRolledFiles(t, "", closed, files, records, 1, 2, 1, 1, 1)
+}
+
+func TestRollingWriterCompressionAuto(t *testing.T) {
+	records := testRecords(12)
+	for _, ct := range compressionTypes {
+		t.Run(ct.String(), func(t *testing.T) {
+			suffix := ".tfrecord" + ct.Extension()
+			closed, files := rollRecords(t, RollingWriterOptions{
+				RecordWriterOptions: RecordWriterOptions{CompressionType: CompressionTypeAuto},
+				MaxRecords:          5,
+				Suffix:              suffix,
+			}, records)
+			checkRolledFiles(t, suffix, closed, files, records, 5, 5, 2)
+			for _, filename := range closed {
+				if got := DetectCompressionType(files[filename]); got != ct {
+					t.Errorf("%s is compressed with %v, want %v", filename, got, ct)
+				}
+			}
+		})
+	}
+}
+
+func TestRollingWriterClose(t *testing.T) {
+	c := &memCreator{files: map[string][]byte{}}
+	w, err := NewRollingWriter("mem/out", &RollingWriterOptions{Creator: c.Create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close of an empty writer returned %v", err)
+	}
+	if len(c.files) != 0 || len(w.ClosedFiles()) != 0 {
+		t.Errorf("empty writer wrote %d files and closed %q", len(c.files), w.ClosedFiles())
+	}
+
+	w, err = NewRollingWriter("mem/out", &RollingWriterOptions{Creator: c.Create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord([]byte("record")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("second Close returned no error")
+	}
+	if want := []string{"mem/out-00001"}; !reflect.DeepEqual(w.ClosedFiles(), want) {
+		t.Errorf("ClosedFiles = %q, want %q", w.ClosedFiles(), want)
+	}
+}
+
+func TestNewRollingWriterInvalidLimits(t *testing.T) {
+	for _, options := range []RollingWriterOptions{{MaxBytes: -1}, {MaxRecords: -1}} {
+		if _, err := NewRollingWriter("mem/out", &options); err == nil {
+			t.Errorf("NewRollingWriter with %d bytes and %d records returned no error", options.MaxBytes, options.MaxRecords)
+		}
+	}
+}
@@ -9,15 +9,6 @@ import (
 	"hash/crc32"
 )
 
-// CompressionType denotes uncompressed or ZLib compression. A ZLib-compressed
-// TFRecord file is can be unziipped using "gunzip."
-type CompressionType int
-
-const (
-	CompressionTypeNone CompressionType = iota
-	CompressionTypeZlib
-)
-
 const (
 	crc32Polynomial = crc32.Castagnoli
 	crc32MaskDelta  = uint32(0xa282ead8)
@@ -1,37 +1,153 @@
 package tfrecord
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 )
 
 // RecordWriterOptions defines the options to open the record writer with.
 type RecordWriterOptions struct {
 	CompressionType CompressionType
+
+	// WriteIndex makes the writer write an index of its records to a sidecar
+	// file named by IndexFilename, for random access with NewIndexedReader.
+	// It is supported by NewWriter and RollingWriter, but not NewWriterFrom,
+	// and only for uncompressed files.
+	WriteIndex bool
 	// TODO: zlibOptions?
 }
 
 // RecordWriter implements a writer that appends tfrecord strings to a
-// output file.  The `dstfile` is the path to the tfrecord file, and the
-// `options` stores a copy of the writer options.
+// output file.  The `dstfile` is the path to the tfrecord file, if any, and
+// the `options` stores a copy of the writer options.
 type RecordWriter struct {
 	f       *os.File
 	dstfile string
 	options *RecordWriterOptions
+
+	// w is where encoded records are written. It is either the destination
+	// writer or the compressor wrapping it.
+	w          io.Writer
+	compressor compressor
+
+	recordsWritten int
+
+	// offset is the number of bytes of encoded records written so far.
+	offset int64
+	// index is where index entries are written if the options ask for an
+	// index, and indexFile is the file it writes to.
+	index     *bufio.Writer
+	indexFile io.Closer
 }
 
 // NewWriter returns a new instance of a tfrecrod writer.
 func NewWriter(path string, options *RecordWriterOptions) (*RecordWriter, error) {
+	if options == nil {
+		options = &RecordWriterOptions{}
+	}
+	if options.CompressionType == CompressionTypeAuto {
+		resolved := *options
+		resolved.CompressionType = CompressionTypeFromPath(path)
+		options = &resolved
+	}
+	if err := checkIndexable(options); err != nil {
+		return nil, err
+	}
+
 	// Try to open the file, if this does not work the writer should fail.
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return nil, err
 	}
 
-	return &RecordWriter{
-		f:       f,
-		dstfile: path,
+	rw, err := newWriter(f, options)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rw.f = f
+	rw.dstfile = path
+
+	if options.WriteIndex {
+		idx, err := os.OpenFile(IndexFilename(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		rw.setIndex(idx)
+	}
+	return rw, nil
+}
+
+// checkIndexable returns an error if the options ask for an index of a
+// compressed file, whose records can't be read at an offset.
+func checkIndexable(options *RecordWriterOptions) error {
+	if options.WriteIndex && options.CompressionType != CompressionTypeNone {
+		return fmt.Errorf("index files require uncompressed records, not %v", options.CompressionType)
+	}
+	return nil
+}
+
+// NewWriterFrom returns a tfrecord writer that writes records to w. Closing
+// the returned writer finishes the compressed stream, if any, but does not
+// close w.
+//
+// CompressionTypeAuto is not supported because there is no file name to infer
+// the compression type from.
+func NewWriterFrom(w io.Writer, options *RecordWriterOptions) (*RecordWriter, error) {
+	if options == nil {
+		options = &RecordWriterOptions{}
+	}
+	if options.CompressionType == CompressionTypeAuto {
+		return nil, errors.New("CompressionTypeAuto requires a destination path")
+	}
+	if options.WriteIndex {
+		return nil, errors.New("WriteIndex requires a destination path")
+	}
+	return newWriter(w, options)
+}
+
+// newWriter returns a writer that writes records to w without an index.
+func newWriter(w io.Writer, options *RecordWriterOptions) (*RecordWriter, error) {
+	c, err := newCompressor(w, options.CompressionType)
+	if err != nil {
+		return nil, err
+	}
+	rw := &RecordWriter{
 		options: options,
-	}, nil
+		w:       w,
+	}
+	if c != nil {
+		rw.w = c
+		rw.compressor = c
+	}
+	return rw, nil
+}
+
+// setIndex makes the writer write index entries to f, which it closes when
+// the writer is closed.
+func (rw *RecordWriter) setIndex(f io.WriteCloser) {
+	rw.index = bufio.NewWriter(f)
+	rw.indexFile = f
+}
+
+// recordWritten accounts for a record with an encoded size of n bytes that
+// has been written, adding it to the index if there is one.
+func (rw *RecordWriter) recordWritten(n int64) error {
+	if rw.index != nil {
+		entry := IndexEntry{Offset: rw.offset, Length: n}
+		if _, err := rw.index.WriteString(entry.String() + "\n"); err != nil {
+			return fmt.Errorf("error writing index: %w", err)
+		}
+	}
+	rw.offset += n
+	rw.recordsWritten++
+	return nil
 }
 
 func (rw *RecordWriter) WriteRecord(data []byte) error {
@@ -45,22 +161,90 @@ func (rw *RecordWriter) WriteRecord(data []byte) error {
 		return err
 	}
 
-	_, err = rw.f.Write(bs)
-	return err
+	if _, err := rw.w.Write(bs); err != nil {
+		return err
+	}
+	return rw.recordWritten(int64(len(bs)))
 }
 
+// WriteRecordFrom writes a record of length bytes read from r, without holding
+// the whole record in memory. The data checksum is computed while the data is
+// copied. If r ends before length bytes, an error is returned and the output
+// is left with a partial record, so it should be discarded.
+func (rw *RecordWriter) WriteRecordFrom(r io.Reader, length int64) error {
+	if length <= 0 {
+		return errors.New("data array is empty")
+	}
+
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint64(header, uint64(length))
+	binary.LittleEndian.PutUint32(header[8:], MaskedCRC(header, 8))
+	if _, err := rw.w.Write(header); err != nil {
+		return err
+	}
+
+	dataCrc := crc32.New(crc)
+	n, err := io.CopyN(io.MultiWriter(rw.w, dataCrc), r, length)
+	if err == io.EOF {
+		return fmt.Errorf("record data ended after %d of %d bytes", n, length)
+	}
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footer, CRCMask(dataCrc.Sum32()))
+	if _, err := rw.w.Write(footer); err != nil {
+		return err
+	}
+	return rw.recordWritten(length + 16)
+}
+
+// NumRecordsWritten returns the number of records that this record writer has
+// written.
+func (rw *RecordWriter) NumRecordsWritten() int {
+	return rw.recordsWritten
+}
+
+// Close finishes the compressed stream, if any, and closes the output file if
+// the writer was created with NewWriter. It also closes the index file, if
+// any.
 func (rw *RecordWriter) Close() error {
-	// Nothing to do since we open and close the file handle on each write.
-	// We might have some extra stuff to handle here in the ZLIB compression
-	// is enabled.
+	var err error
+	if rw.compressor != nil {
+		err = rw.compressor.Close()
+		rw.compressor = nil
+	}
+	if rw.index != nil {
+		if flushErr := rw.index.Flush(); err == nil {
+			err = flushErr
+		}
+		if closeErr := rw.indexFile.Close(); err == nil {
+			err = closeErr
+		}
+		rw.index, rw.indexFile = nil, nil
+	}
 	if rw.f != nil {
-		rw.f.Close()
+		if closeErr := rw.f.Close(); err == nil {
+			err = closeErr
+		}
+		rw.f = nil
 	}
-	return nil
+	return err
 }
 
+// Flush writes any buffered compressed data to the output file, and any
+// buffered index entries to the index file. Records written before Flush are
+// readable from the file once Flush returns, but the compressed stream is only
+// terminated by Close.
 func (rw *RecordWriter) Flush() error {
-	// Nothing to do yet, once ZLIB compression is supported we will have to
-	// flush that stream to file as needed.
-	return nil
+	if rw.index != nil {
+		if err := rw.index.Flush(); err != nil {
+			return err
+		}
+	}
+	if rw.compressor == nil {
+		return nil
+	}
+	return rw.compressor.Flush()
 }
@@ -3,7 +3,6 @@ package tfrecordio
 import (
 	"context"
 	"fmt"
-	"hash/fnv"
 	"reflect"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
@@ -17,27 +16,167 @@ import (
 func init() {
 	runtime.RegisterType(reflect.TypeOf((*writeFileFn)(nil)).Elem())
 	schema.RegisterType(reflect.TypeOf((*writeFileFn)(nil)).Elem())
+}
+
+// WriteMode selects how WriteSharded moves records into shard files.
+type WriteMode int
+
+const (
+	// WriteModeGroupByShard assigns each record to a shard and groups the
+	// records by shard, so all of a shard's records pass through a single
+	// GroupByKey value. This is the default.
+	WriteModeGroupByShard WriteMode = iota
+
+	// WriteModeBundleFiles writes the records of each bundle to a temporary
+	// file as they are processed, shuffles only the names of the temporary
+	// files, and then copies the temporary files into the final shards one
+	// record at a time. Memory use is bounded by the size of a single record
+	// regardless of how large the shards are, at the cost of writing every
+	// record twice. Each shard holds whole temporary files, so shard sizes are
+	// less even than with WriteModeGroupByShard.
+	WriteModeBundleFiles
+)
+
+// WriteOption configures WriteSharded.
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	mode            WriteMode
+	compressionType tfrecord.CompressionType
+	manifest        bool
+	sharding        ShardingStrategy
+	shardName       ShardNameTemplate
+
+	targetShardBytes   int64
+	targetShardRecords int64
+}
+
+// newWriteOptions applies opts to the default options of a write transform
+// whose default shard name template is defaultShardName.
+func newWriteOptions(defaultShardName ShardNameTemplate, opts []WriteOption) writeOptions {
+	o := writeOptions{sharding: ShardByContentHash(), shardName: defaultShardName}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shardName.Template == "" {
+		o.shardName.Template = defaultShardName.Template
+	}
+	return o
+}
+
+// WithWriteMode sets how WriteSharded moves records into shard files.
+func WithWriteMode(mode WriteMode) WriteOption {
+	return func(o *writeOptions) { o.mode = mode }
+}
+
+// WithCompression sets the compression type of the shard files. The default
+// is tfrecord.CompressionTypeNone.
+func WithCompression(ct tfrecord.CompressionType) WriteOption {
+	return func(o *writeOptions) { o.compressionType = ct }
+}
+
+// WithManifest makes WriteSharded write a JSON manifest that lists every shard
+// once all of the shards have been committed. See ManifestFilename and
+// ReadManifest.
+func WithManifest() WriteOption {
+	return func(o *writeOptions) { o.manifest = true }
+}
+
+// shardedOutput describes the shard files written by WriteSharded. It is
+// serialized into the DoFns that write and commit the shards. The number of
+// shards may only be known at runtime, so it is passed to those DoFns as a
+// side input instead.
+type shardedOutput struct {
+	Prefix          string                   `json:"prefix"`
+	ShardName       ShardNameTemplate        `json:"shardName"`
+	TempDir         string                   `json:"tempDir"`
+	CompressionType tfrecord.CompressionType `json:"compressionType"`
+}
 
-	runtime.RegisterType(reflect.TypeOf((*assignShardNumberFn)(nil)).Elem())
-	schema.RegisterType(reflect.TypeOf((*assignShardNumberFn)(nil)).Elem())
+// shardFilename returns the final name of a shard.
+func (o shardedOutput) shardFilename(id shardID) string {
+	return o.ShardName.filename(o.Prefix, id, o.CompressionType)
 }
 
-func shardNum(data []byte, shardCount int) int {
-	h := fnv.New32a()
-	h.Write(data)
-	return int(h.Sum32()) % shardCount
+// compressionType returns the compression type of the named shard file.
+func (o shardedOutput) compressionType(filename string) tfrecord.CompressionType {
+	if o.CompressionType == tfrecord.CompressionTypeAuto {
+		return tfrecord.CompressionTypeFromPath(filename)
+	}
+	return o.CompressionType
 }
 
 // WriteSharded writes a PCollection<[]byte]> to a file using tfrecord format.
-func WriteSharded(s beam.Scope, filenamePrefix string, shardCount int, col beamgen.Collection[[]byte]) {
-	type T = []byte
+// It returns a PCollection with a ShardInfo for each shard file, which holds
+// elements once the shard has been committed under its final name.
+//
+// Shard files are named by appending DefaultShardNameTemplate to
+// filenamePrefix, unless WithShardNameTemplate is given.
+//
+// The filename prefix may use any filesystem registered with Beam's filesystem
+// package, such as gs:// or memfs://. The filesystem implementation must be
+// imported by the pipeline binary.
+//
+// Shards are first written to uniquely named temporary files in a directory
+// next to the output, and are only renamed to their final names once every
+// shard has been written successfully. Retried or zombie bundles therefore
+// never leave partial shards under the output prefix, and their temporary
+// files are removed with the rest of the write's temporary directory when the
+// output is committed. Temporary directories of other writes to the same
+// prefix are left alone, since they may still be in use; use RemoveTempFiles
+// to remove those of pipelines that failed.
+//
+// If WithTargetShardBytes or WithTargetShardRecords is used, shardCount must
+// be zero and the number of shards is computed from the size of col once all
+// of it has been produced.
+//
+// col must be bounded and in the global window. Use WriteWindowed to write
+// windowed or unbounded collections.
+func WriteSharded(s beam.Scope, filenamePrefix string, shardCount int, col beamgen.Collection[[]byte], opts ...WriteOption) beamgen.Collection[ShardInfo] {
 	s = s.Scope("tfrecord.Write")
 
-	if shardCount <= 0 {
-		panic(fmt.Errorf("invalid shardCount %d <= 0", shardCount))
+	filesystem.ValidateScheme(filenamePrefix)
+
+	o := newWriteOptions(DefaultShardNameTemplate, opts)
+	if err := o.shardName.validate(false); err != nil {
+		panic(err)
 	}
 
-	filesystem.ValidateScheme(filenamePrefix)
+	out := shardedOutput{
+		Prefix:          filenamePrefix,
+		ShardName:       o.shardName,
+		TempDir:         tempDirectory(filenamePrefix),
+		CompressionType: o.compressionType,
+	}
+	count := shardCountFor(s, shardCount, o, col)
+
+	var pending beamgen.Collection[pendingShard]
+	switch o.mode {
+	case WriteModeGroupByShard:
+		pending = writeGroupedByShard(s, out, count, o.sharding, col)
+	case WriteModeBundleFiles:
+		pending = writeBundleFiles(s, out, count, col)
+	default:
+		panic(fmt.Errorf("invalid write mode %d", o.mode))
+	}
+
+	infos := finalizeShards(s, out, count, pending)
+	if o.manifest {
+		writeManifest(s, out, count, infos)
+	}
+	return infos
+}
+
+// writeGroupedByShard implements WriteModeGroupByShard.
+func writeGroupedByShard(s beam.Scope, out shardedOutput, shardCount beamgen.Collection[int], sharding ShardingStrategy, col beamgen.Collection[[]byte]) beamgen.Collection[pendingShard] {
+	post := groupByShard(s, shardCount, sharding, col)
+	return beamgen.ParDoUnsafe[beamgen.GroupedByKey[int, []byte], pendingShard](s, &writeFileFn{Output: out}, post,
+		beam.SideInput{Input: shardCount.PCollection()})
+}
+
+// groupByShard assigns each record to a shard and groups the records by shard.
+func groupByShard(s beam.Scope, shardCount beamgen.Collection[int], sharding ShardingStrategy, col beamgen.Collection[[]byte]) beamgen.Collection[beamgen.GroupedByKey[int, []byte]] {
+	type T = []byte
 
 	// NOTE(BEAM-3579): We may never call Teardown for non-local runners and
 	// FinishBundle doesn't have the right granularity. We therefore
@@ -45,57 +184,45 @@ func WriteSharded(s beam.Scope, filenamePrefix string, shardCount int, col beamg
 
 	// TODO(BEAM-3860) 3/15/2018: use side input instead of GBK.
 
-	pre := beamgen.ParDoKV[T, int, T](s.Scope("AssignShardNumber"), &assignShardNumberFn{shardCount}, col)
+	pre := beamgen.ParDoUnsafe[T, beamgen.KV[int, T]](s.Scope("AssignShardNumber"), sharding.assignShardFn(), col,
+		beam.SideInput{Input: shardCount.PCollection()})
 
 	//pre := beamgen.AddFixedKey(s, col)
-	post := beamgen.GroupByKey(s, pre)
-	beamgen.ParDoGBK0[int, T](s, &writeFileFn{Filename: filenamePrefix, ShardCount: shardCount}, post)
+	return beamgen.GroupByKey(s, pre)
 }
 
-type assignShardNumberFn struct {
-	ShardCount int
+type writeFileFn struct {
+	Output shardedOutput `json:"output"`
 }
 
-func (f *assignShardNumberFn) ProcessElement(ctx context.Context, record []byte, emit func(int, []byte)) error {
-	emit(shardNum(record, f.ShardCount), record)
+func (w *writeFileFn) ProcessElement(ctx context.Context, shard int, protos func(*[]byte) bool, shardCount int, emit func(pendingShard)) error {
+	pending, err := writeShard(ctx, w.Output, globalShardID(shard, shardCount), protos)
+	if err != nil {
+		return err
+	}
+	emit(pending)
 	return nil
 }
 
-type writeFileFn struct {
-	Filename   string `json:"filename"`
-	ShardCount int    `json:"shardCount"`
-}
-
-func (w *writeFileFn) ProcessElement(ctx context.Context, shard int, protos func(*[]byte) bool) error {
-	fs, err := filesystem.New(ctx, w.Filename)
+// writeShard writes the records of a shard to a temporary file.
+func writeShard(ctx context.Context, out shardedOutput, id shardID, records func(*[]byte) bool) (pendingShard, error) {
+	fs, err := filesystem.New(ctx, out.Prefix)
 	if err != nil {
-		return err
+		return pendingShard{}, err
 	}
 	defer fs.Close()
 
-	shardName := fmt.Sprintf("%05d-of-%05d", shard+1, w.ShardCount)
-
-	filename := w.Filename + "-" + shardName
-	recordWriter, err := tfrecord.NewWriter(filename, &tfrecord.RecordWriterOptions{
-		CompressionType: tfrecord.CompressionTypeNone,
-	})
+	shardWriter, err := newShardFileWriter(ctx, fs, out, id)
 	if err != nil {
-		return fmt.Errorf("error creating record writer: %w", err)
+		return pendingShard{}, err
 	}
 
 	var elem []byte
-	for protos(&elem) {
-		if err := recordWriter.WriteRecord(elem); err != nil {
-			return fmt.Errorf("error writing proto to TFRecord file: %w", err)
+	for records(&elem) {
+		if err := shardWriter.WriteRecord(elem); err != nil {
+			shardWriter.Abort()
+			return pendingShard{}, err
 		}
 	}
-
-	if err := recordWriter.Flush(); err != nil {
-		return fmt.Errorf("error flushing bytes to TFRecord file: %w", err)
-	}
-
-	if err := recordWriter.Close(); err != nil {
-		return fmt.Errorf("error closing TFRecord file: %w", err)
-	}
-	return nil
+	return shardWriter.Close()
 }
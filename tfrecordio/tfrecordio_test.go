@@ -0,0 +1,18 @@
+package tfrecordio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWriteShardedThenRead(t *testing.T) {
+	records := testRecords(500)
+	prefix := "memfs://roundtrip/out"
+	writeRecords(t, prefix, 3, records, WithSharding(ShardRoundRobin()))
+
+	want := []string{prefix + "-00001-of-00003", prefix + "-00002-of-00003", prefix + "-00003-of-00003"}
+	if got := listFiles(t, prefix+"-.*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("output files = %q, want %q", got, want)
+	}
+	checkRead(t, prefix+"-.*", records)
+}
@@ -0,0 +1,142 @@
+package tfrecordio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/schema"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+)
+
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*writeWindowedFileFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*writeWindowedFileFn)(nil)).Elem())
+
+	runtime.RegisterType(reflect.TypeOf((*finalizeWindowedShardFn)(nil)).Elem())
+	schema.RegisterType(reflect.TypeOf((*finalizeWindowedShardFn)(nil)).Elem())
+}
+
+// WriteWindowed writes a windowed, possibly unbounded, PCollection<[]byte> in
+// TFRecord format. Each pane of each window is written to its own set of up to
+// shardCount shards when the pane fires, so the windowing strategy and trigger
+// of col control when files are written. Each shard is committed as soon as it
+// has been written, so the shards of a pane appear one at a time rather than
+// together. It returns a PCollection with a ShardInfo for each committed shard,
+// in the window of the shard.
+//
+// Shard files are named by appending DefaultWindowedShardNameTemplate to
+// filenamePrefix, unless WithShardNameTemplate is given. The template must
+// name shards by window and pane.
+//
+// Unlike WriteSharded, shards that receive no records in a pane are not
+// written, and the directory of temporary files is left in place because more
+// panes may arrive. Once the pipeline has stopped, call RemoveTempFiles with
+// the same filenamePrefix to remove it, along with any temporary files of
+// failed attempts. WriteModeBundleFiles, WithManifest and target shard sizes
+// are not supported.
+func WriteWindowed(s beam.Scope, filenamePrefix string, shardCount int, col beamgen.Collection[[]byte], opts ...WriteOption) beamgen.Collection[ShardInfo] {
+	s = s.Scope("tfrecord.WriteWindowed")
+
+	filesystem.ValidateScheme(filenamePrefix)
+
+	o := newWriteOptions(DefaultWindowedShardNameTemplate, opts)
+	switch {
+	case o.mode != WriteModeGroupByShard:
+		panic(fmt.Errorf("WriteWindowed doesn't support write mode %d", o.mode))
+	case o.manifest:
+		panic(fmt.Errorf("WriteWindowed doesn't support manifests"))
+	case o.targetShardBytes != 0 || o.targetShardRecords != 0:
+		panic(fmt.Errorf("WriteWindowed doesn't support target shard sizes"))
+	}
+	if err := o.shardName.validate(true); err != nil {
+		panic(err)
+	}
+
+	out := shardedOutput{
+		Prefix:          filenamePrefix,
+		ShardName:       o.shardName,
+		TempDir:         tempDirectory(filenamePrefix),
+		CompressionType: o.compressionType,
+	}
+	count := shardCountFor(s, shardCount, o, col)
+
+	grouped := groupByShard(s, count, o.sharding, col)
+	pending := beamgen.ParDoUnsafe[beamgen.GroupedByKey[int, []byte], pendingShard](s, &writeWindowedFileFn{Output: out}, grouped,
+		beam.SideInput{Input: count.PCollection()})
+
+	// Reshuffle keeps the window of each shard but, unlike a GroupByKey,
+	// doesn't apply the trigger of col again, which could hold back shards
+	// until more of them arrive. It also makes the input of the commit
+	// stable, so retrying it never writes the shard again.
+	s = s.Scope("FinalizeShards")
+	pending = beamgen.Reshuffle(s, pending)
+	return beamgen.ParDoUnsafe[pendingShard, ShardInfo](s, &finalizeWindowedShardFn{Output: out}, pending)
+}
+
+// writeWindowedFileFn writes the records of a shard of one window and pane to
+// a temporary file.
+type writeWindowedFileFn struct {
+	Output shardedOutput `json:"output"`
+}
+
+func (w *writeWindowedFileFn) ProcessElement(ctx context.Context, pane typex.PaneInfo, window typex.Window, shard int, records func(*[]byte) bool, shardCount int, emit func(pendingShard)) error {
+	id := shardID{
+		Shard:      shard,
+		ShardCount: shardCount,
+		Window:     windowName(window),
+		Pane:       paneName(pane),
+	}
+	pending, err := writeShard(ctx, w.Output, id, records)
+	if err != nil {
+		return err
+	}
+	emit(pending)
+	return nil
+}
+
+// finalizeWindowedShardFn commits a shard of one window and pane. It is safe
+// to retry, since commitShard skips shards that were already renamed.
+type finalizeWindowedShardFn struct {
+	Output shardedOutput `json:"output"`
+}
+
+func (f *finalizeWindowedShardFn) ProcessElement(ctx context.Context, shard pendingShard, emit func(ShardInfo)) error {
+	fs, err := filesystem.New(ctx, f.Output.TempDir)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	if err := commitShard(ctx, fs, shard); err != nil {
+		return err
+	}
+	removeTempFiles(ctx, fs, f.Output.TempDir, shard.Info.Filename)
+	emit(shard.Info)
+	return nil
+}
+
+// removeTempFiles removes the temporary files that other attempts at writing
+// a shard left in tempDir. Failures are logged rather than returned because
+// the shard has already been committed.
+func removeTempFiles(ctx context.Context, fs filesystem.Interface, tempDir, finalName string) {
+	rm, ok := fs.(filesystem.Remover)
+	if !ok {
+		return
+	}
+	leftovers, err := fs.List(ctx, tempDir+baseName(finalName)+".*")
+	if err != nil {
+		log.Warnf(ctx, "Failed to list temporary files of %v: %v", finalName, err)
+		return
+	}
+	for _, filename := range leftovers {
+		if err := rm.Remove(ctx, filename); err != nil {
+			log.Warnf(ctx, "Failed to remove temporary file %v: %v", filename, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package tfrecordio
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window/trigger"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/gonzojive/beam-go-bazel-example/beamgen"
+)
+
+// timestampByLengthFn gives each record a timestamp of as many minutes as it
+// has bytes.
+func timestampByLengthFn(record []byte) (beam.EventTime, []byte) {
+	return mtime.FromTime(time.Unix(0, 0).Add(time.Duration(len(record)) * time.Minute)), record
+}
+
+func shardInfoFilename(info ShardInfo) string {
+	return info.Filename
+}
+
+func TestWriteWindowedCommitsEveryShard(t *testing.T) {
+	records := testRecords(60)
+	prefix := "memfs://windowed/out"
+
+	p, s := beam.NewPipelineWithRoot()
+	col := beam.ParDo(s, timestampByLengthFn, beamgen.Create(s, records...).PCollection())
+	// The records fall in two windows. The trigger fires after more elements
+	// than there are shards in a pane, so it must only apply to records.
+	col = beam.WindowInto(s, window.NewFixedWindows(30*time.Minute), col,
+		beam.Trigger(trigger.Repeat(trigger.AfterCount(100))), beam.PanesDiscard())
+	infos := WriteWindowed(s, prefix, 2, beamgen.AssertType[[]byte](col), WithSharding(ShardRoundRobin()))
+	filenames := beam.WindowInto(s, window.NewGlobalWindows(), beam.ParDo(s, shardInfoFilename, infos.PCollection()))
+	passert.Count(s, filenames, "shards", 4)
+	if err := ptest.Run(p); err != nil {
+		t.Fatal(err)
+	}
+
+	files := listFiles(t, prefix+"-.*")
+	if len(files) != 4 {
+		t.Fatalf("WriteWindowed wrote %q, want 2 shards in each of 2 windows", files)
+	}
+	for _, f := range files {
+		if !strings.Contains(f, "-pane-") {
+			t.Errorf("shard %s isn't named by window and pane", f)
+		}
+	}
+	checkRead(t, prefix+"-.*", records)
+
+	if err := RemoveTempFiles(context.Background(), prefix); err != nil {
+		t.Fatal(err)
+	}
+	if got := listFiles(t, tempRoot(prefix)+".*"); len(got) != 0 {
+		t.Errorf("temporary files left after RemoveTempFiles: %q", got)
+	}
+}